@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/1F47E/holler/identity"
+	"github.com/1F47E/holler/message"
+	"github.com/spf13/cobra"
+)
+
+// summarizerTimeout bounds one run of the --summarizer command.
+const summarizerTimeout = 2 * time.Minute
+
+var (
+	contextMaxChars   int
+	contextSummarizer string
+)
+
+func init() {
+	contextCmd.Flags().IntVar(&contextMaxChars, "max-chars", 0, "Longest transcript to print, in characters (0 = no limit)")
+	contextCmd.Flags().StringVar(&contextSummarizer, "summarizer", "", "Shell command that summarizes older turns from stdin when over --max-chars")
+	rootCmd.AddCommand(contextCmd)
+}
+
+var contextCmd = &cobra.Command{
+	Use:   "context <thread-id|msg-id|contact>",
+	Short: "Print a conversation as a compact transcript for a language model prompt",
+	Long: `Print a conversation from both the inbox and the sent log as a compact
+transcript for a language model prompt.
+
+The argument is a contact alias or onion address (every message with that
+peer), or a thread ID or any message in the thread. Each turn is tagged with
+its speaker ("self" for your own messages), time, type, IDs and meta, and
+UNVERIFIED if its signature doesn't check out.
+
+With --max-chars the newest turns that fit are kept whole and older ones are
+dropped with a note. --summarizer replaces that note with a summary: the
+command runs under sh with the older turns on stdin and
+HOLLER_SUMMARY_MAX_CHARS set to the room left, and its output is used,
+cut to fit.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if contextMaxChars < 0 {
+			return fmt.Errorf("--max-chars must not be negative")
+		}
+		contacts, _ := identity.LoadContacts()
+		var q message.Query
+		if peer := contacts.Resolve(args[0]); identity.ValidOnionAddr(peer) {
+			q.Peer = peer
+		} else {
+			q.ThreadID = args[0]
+		}
+		conv, err := newConversation(q, contacts)
+		if err != nil {
+			return err
+		}
+
+		var summarize func(string, int, int) string
+		if contextSummarizer != "" {
+			summarize = runSummarizer
+		}
+		fmt.Print(conv.Transcript(contextMaxChars, summarize))
+		return nil
+	},
+}
+
+// runSummarizer pipes transcript through the --summarizer command and
+// returns its output. Failures are reported and yield no summary.
+func runSummarizer(transcript string, turns, maxChars int) string {
+	ctx, cancel := context.WithTimeout(context.Background(), summarizerTimeout)
+	defer cancel()
+
+	c := exec.CommandContext(ctx, "sh", "-c", contextSummarizer)
+	c.Stdin = strings.NewReader(transcript)
+	c.Env = append(os.Environ(),
+		fmt.Sprintf("HOLLER_SUMMARY_MAX_CHARS=%d", maxChars),
+		fmt.Sprintf("HOLLER_SUMMARY_TURNS=%d", turns),
+	)
+	var out bytes.Buffer
+	c.Stdout = &out
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "summarizer: %v — leaving %d earlier turn(s) out\n", err, turns)
+		return ""
+	}
+	return out.String()
+}
@@ -47,6 +47,10 @@ var daemonStartCmd = &cobra.Command{
 			return fmt.Errorf("daemon already running (PID %d)", pid)
 		}
 
+		if _, err := loadTransport(); err != nil {
+			return err
+		}
+
 		// Validate tor_key exists
 		if _, err := node.LoadOrCreateOnionKey(hollerDir); err != nil {
 			return fmt.Errorf("no identity — run 'holler init' first: %w", err)
@@ -67,6 +71,9 @@ var daemonStartCmd = &cobra.Command{
 		if node.Verbose {
 			execArgs = append(execArgs, "--verbose")
 		}
+		if transportName != node.TransportTor {
+			execArgs = append(execArgs, "--transport", transportName)
+		}
 
 		daemonCmd := exec.Command(os.Args[0], execArgs...)
 		daemonCmd.Stdout = logFile
@@ -159,6 +166,14 @@ var daemonStatusCmd = &cobra.Command{
 			fmt.Println("Daemon: stopped")
 		}
 
+		// Show receive counters saved by the daemon
+		if stats := node.LoadStats(hollerDir); len(stats) > 0 {
+			fmt.Println("\nCounters:")
+			for _, name := range node.SortedStatNames(stats) {
+				fmt.Printf("  %-28s %d\n", name, stats[name])
+			}
+		}
+
 		// Show last 5 lines of log
 		logPath := logFilePath(hollerDir)
 		if lines := tailFile(logPath, 5); len(lines) > 0 {
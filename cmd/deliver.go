@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	bineed25519 "github.com/cretz/bine/torutil/ed25519"
+
+	"github.com/1F47E/holler/message"
+	"github.com/1F47E/holler/node"
+)
+
+// nackError is a delivery the recipient refused with a signed nack.
+type nackError struct {
+	code   string
+	reason string
+}
+
+func (e *nackError) Error() string {
+	return fmt.Sprintf("%s (%s)", e.reason, e.code)
+}
+
+// permanent reports whether resending can never succeed.
+func (e *nackError) permanent() bool {
+	return node.NackPermanent(e.code)
+}
+
+// deliver signs env for its recipient with kp, sends it and returns the
+// peer's verified reply.
+// A nack is returned as a *nackError alongside the reply, except a duplicate
+// nack: the peer already has the message, which counts as delivered.
+// When the peer demands proof-of-work, the stamp is minted at the requested
+// difficulty and the envelope re-sent once on a fresh connection.
+// Errors wrapping node.ErrNoReply mean the envelope was written but not answered.
+func deliver(ctx context.Context, tr node.Transport, kp bineed25519.KeyPair, env *message.Envelope) (*message.Envelope, error) {
+	c, err := node.Connect(ctx, tr, env.To)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	return deliverOn(ctx, c, kp, env)
+}
+
+// deliverOn is deliver over an already connected client.
+func deliverOn(ctx context.Context, c *node.Client, kp bineed25519.KeyPair, env *message.Envelope) (*message.Envelope, error) {
+	if err := signFor(c, kp, env); err != nil {
+		return nil, err
+	}
+	reply, err := exchange(ctx, c, env)
+	var nack *nackError
+	if !errors.As(err, &nack) || nack.code != node.NackPoWRequired {
+		return reply, err
+	}
+
+	bits, perr := strconv.Atoi(reply.Meta["pow"])
+	if perr != nil || bits <= 0 {
+		return reply, err
+	}
+	if bits > message.MaxPoWBits {
+		return reply, &nackError{
+			code:   node.NackPoWRequired,
+			reason: fmt.Sprintf("recipient demands %d bits of proof-of-work, more than the %d we will mint", bits, message.MaxPoWBits),
+		}
+	}
+	// Minting can outlast the peer's idle timeout: hang up first and let
+	// the resend dial again.
+	c.Close()
+	fmt.Fprintf(os.Stderr, "Computing %d-bit proof-of-work for %s.onion...\n", bits, env.To[:16])
+	if err := env.MintPoW(ctx, bits); err != nil {
+		return nil, err
+	}
+	return exchange(ctx, c, env)
+}
+
+// signFor re-signs env in the version the peer on c verifies, if it isn't
+// already. A proof-of-work stamp covers the old payload, so it is dropped.
+func signFor(c *node.Client, kp bineed25519.KeyPair, env *message.Envelope) error {
+	v := c.SigVersion()
+	if env.V == v {
+		return nil
+	}
+	env.V, env.PoW = v, ""
+	if err := env.Sign(kp); err != nil {
+		return fmt.Errorf("sign message: %w", err)
+	}
+	return nil
+}
+
+// exchange performs a single send and reply round trip, checking that the
+// reply answers env and is signed by the recipient. A nack for a frame the
+// peer couldn't decode has an empty body.
+func exchange(ctx context.Context, c *node.Client, env *message.Envelope) (*message.Envelope, error) {
+	reply, err := c.Exchange(ctx, env)
+	if err != nil {
+		return nil, err
+	}
+	answers := reply.Body == env.ID || (reply.Type == "nack" && reply.Body == "")
+	if !answers || reply.From != env.To {
+		return nil, fmt.Errorf("%w: unexpected %s reply", node.ErrNoReply, reply.Type)
+	}
+	if valid, verr := reply.Verify(); verr != nil || !valid {
+		return nil, fmt.Errorf("%w: %s signature invalid", node.ErrNoReply, reply.Type)
+	}
+	if reply.Type == "nack" && reply.Meta["code"] != node.NackDuplicate {
+		return reply, &nackError{code: reply.Meta["code"], reason: reply.Meta["reason"]}
+	}
+	return reply, nil
+}
@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/1F47E/holler/export"
+	"github.com/1F47E/holler/identity"
+	"github.com/1F47E/holler/message"
+	"github.com/1F47E/holler/node"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportFormat  string
+	exportOutput  string
+	exportPeer    string
+	exportFilters queryFlags
+)
+
+func init() {
+	exportCmd.Flags().StringVarP(&exportFormat, "format", "f", export.FormatMarkdown, "Output format: md, html, json or maildir")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Output file, or directory for maildir (default stdout)")
+	exportCmd.Flags().StringVar(&exportPeer, "peer", "", "Only the conversation with this peer (alias or onion address)")
+	exportFilters.register(exportCmd)
+	rootCmd.AddCommand(exportCmd)
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export conversations as Markdown, HTML, JSON or a Maildir",
+	Long: `Export received and sent messages, oldest first, for people to read or to
+archive in other tools.
+
+Pick the messages with --thread (a thread ID, or any message in it), --peer,
+--since/--until and the other filters 'holler inbox' takes; without any,
+everything is exported. Each message shows whether its signature verifies.
+
+  md       Markdown document
+  html     standalone HTML page, no scripts or external resources
+  json     one JSON document: {"title", "exported", "messages": [{"mailbox",
+           "signature", "envelope"}]}
+  maildir  a Maildir (tmp/new/cur) with one RFC 5322 mail per message;
+           reply_to becomes In-Reply-To so mail clients thread it. Messages
+           already in the Maildir are skipped.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch exportFormat {
+		case export.FormatMarkdown, export.FormatHTML, export.FormatJSON:
+		case export.FormatMaildir:
+			if exportOutput == "" {
+				return fmt.Errorf("--format maildir needs --output <directory>")
+			}
+		default:
+			return fmt.Errorf("invalid --format %q: must be md, html, json or maildir", exportFormat)
+		}
+
+		q, err := exportFilters.query()
+		if err != nil {
+			return err
+		}
+		contacts, _ := identity.LoadContacts()
+		if exportPeer != "" {
+			q.Peer = contacts.Resolve(exportPeer)
+		}
+
+		conv, err := newConversation(q, contacts)
+		if err != nil {
+			return err
+		}
+		msgs := conv.Messages
+		invalid := 0
+		for _, m := range msgs {
+			if m.Signature != export.SigVerified {
+				invalid++
+			}
+		}
+		if invalid > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: %d message(s) did not verify\n", invalid)
+		}
+
+		if exportFormat == export.FormatMaildir {
+			added, err := conv.Maildir(exportOutput)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Exported %d message(s) to %s (%d already there)\n", added, exportOutput, len(msgs)-added)
+			return nil
+		}
+
+		var w io.Writer = os.Stdout
+		if exportOutput != "" {
+			f, err := os.Create(exportOutput)
+			if err != nil {
+				return fmt.Errorf("create %s: %w", exportOutput, err)
+			}
+			defer f.Close()
+			w = f
+		}
+		switch exportFormat {
+		case export.FormatHTML:
+			err = conv.HTML(w)
+		case export.FormatJSON:
+			err = conv.JSON(w)
+		default:
+			err = conv.Markdown(w)
+		}
+		if err != nil {
+			return err
+		}
+		if exportOutput != "" {
+			fmt.Fprintf(os.Stderr, "Exported %d message(s) to %s\n", len(msgs), exportOutput)
+		}
+		return nil
+	},
+}
+
+// newConversation gathers the messages selected by q, checks their
+// signatures and names their peers by contact alias.
+func newConversation(q message.Query, contacts identity.Contacts) (*export.Conversation, error) {
+	hollerDir, err := identity.HollerDir()
+	if err != nil {
+		return nil, err
+	}
+	onionKey, err := node.LoadOrCreateOnionKey(hollerDir)
+	if err != nil {
+		return nil, err
+	}
+	st, err := message.OpenStore(hollerDir)
+	if err != nil {
+		return nil, err
+	}
+	msgs, title, err := exportMessages(st, q, contacts)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, fmt.Errorf("no matching messages")
+	}
+	states, err := st.States()
+	if err != nil {
+		return nil, err
+	}
+
+	conv := &export.Conversation{
+		Title:    title,
+		Self:     identity.OnionAddrFromKey(onionKey),
+		Names:    make(map[string]string, len(contacts)),
+		Exported: time.Now(),
+	}
+	for alias, addr := range contacts {
+		conv.Names[addr] = alias
+	}
+	for _, m := range msgs {
+		conv.Messages = append(conv.Messages, export.NewMessage(m.Mailbox, m.Envelope, message.StateOf(states, m.Envelope).Read))
+	}
+	return conv, nil
+}
+
+// exportMessages returns the inbox and sent messages selected by q, oldest
+// first with parents ahead of same-second replies, and a title describing
+// the selection. A thread is found by findThread, so q.ThreadID may be any
+// message in it.
+func exportMessages(st message.Store, q message.Query, contacts identity.Contacts) ([]message.ThreadMessage, string, error) {
+	var msgs []message.ThreadMessage
+	var title []string
+	if q.ThreadID != "" {
+		id, thread, err := findThread(st, q.ThreadID)
+		if err != nil {
+			return nil, "", err
+		}
+		q.ThreadID = ""
+		for _, m := range thread {
+			if q.Match(m.Mailbox, m.Envelope, message.MessageState{}) {
+				msgs = append(msgs, m)
+			}
+		}
+		title = append(title, "Thread "+id)
+	} else {
+		seen := make(map[string]bool)
+		for _, box := range []message.Mailbox{message.MailboxInbox, message.MailboxSent} {
+			envs, err := st.Messages(box, q)
+			if err != nil {
+				return nil, "", err
+			}
+			for _, env := range envs {
+				if !seen[env.Key()] {
+					seen[env.Key()] = true
+					msgs = append(msgs, message.ThreadMessage{Mailbox: box, Envelope: env})
+				}
+			}
+		}
+		sort.SliceStable(msgs, func(i, j int) bool {
+			return msgs[i].Envelope.Ts < msgs[j].Envelope.Ts
+		})
+		title = append(title, "Messages")
+	}
+	lines := chronological(replyTree(msgs))
+	for i, line := range lines {
+		msgs[i] = line.msg
+	}
+
+	if q.Peer != "" {
+		title = append(title, "with "+displayOnion(contacts, q.Peer))
+	}
+	if q.Since != 0 {
+		title = append(title, "since "+time.Unix(q.Since, 0).Format("2006-01-02 15:04"))
+	}
+	if q.Until != 0 {
+		title = append(title, "until "+time.Unix(q.Until, 0).Format("2006-01-02 15:04"))
+	}
+	return msgs, strings.Join(title, " "), nil
+}
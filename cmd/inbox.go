@@ -1,10 +1,12 @@
 package cmd
 
 import (
-	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
 	"time"
 
 	"github.com/1F47E/holler/identity"
@@ -13,15 +15,31 @@ import (
 )
 
 var (
-	inboxLast int
-	inboxFrom string
-	inboxJSON bool
+	inboxLast     int
+	inboxFrom     string
+	inboxJSON     bool
+	inboxUnread   bool
+	inboxArchived bool
+	inboxLabel    string
+	inboxFilters  queryFlags
+
+	inboxMarkReadAll bool
+	inboxArchiveUndo bool
+	inboxLabelRm     bool
 )
 
 func init() {
 	inboxCmd.Flags().IntVarP(&inboxLast, "last", "n", 0, "Show last N messages (0 = all)")
 	inboxCmd.Flags().StringVar(&inboxFrom, "from", "", "Filter by sender (alias or onion address)")
-	inboxCmd.Flags().BoolVar(&inboxJSON, "json", false, "Raw JSONL output")
+	inboxCmd.Flags().BoolVar(&inboxJSON, "json", false, "Raw JSONL output, with each message's state")
+	inboxCmd.Flags().BoolVar(&inboxUnread, "unread", false, "Only messages not yet marked read")
+	inboxCmd.Flags().BoolVar(&inboxArchived, "archived", false, "Include archived messages")
+	inboxCmd.Flags().StringVar(&inboxLabel, "label", "", "Only messages with this label")
+	inboxFilters.register(inboxCmd)
+	inboxMarkReadCmd.Flags().BoolVar(&inboxMarkReadAll, "all", false, "Mark every unread message read")
+	inboxArchiveCmd.Flags().BoolVar(&inboxArchiveUndo, "undo", false, "Move the message back to the inbox")
+	inboxLabelCmd.Flags().BoolVar(&inboxLabelRm, "rm", false, "Remove the label instead")
+	inboxCmd.AddCommand(inboxMarkReadCmd, inboxArchiveCmd, inboxLabelCmd)
 	rootCmd.AddCommand(inboxCmd)
 }
 
@@ -34,50 +52,50 @@ var inboxCmd = &cobra.Command{
 			return err
 		}
 
-		envelopes, err := loadInbox(hollerDir)
+		st, err := message.OpenStore(hollerDir)
 		if err != nil {
 			return err
 		}
 
-		if len(envelopes) == 0 {
-			fmt.Println("Inbox is empty.")
-			return nil
+		q, err := inboxFilters.query()
+		if err != nil {
+			return err
 		}
+		q.Last = inboxLast
+		q.Unread = inboxUnread
+		q.SkipArchived = !inboxArchived
+		q.Label = inboxLabel
 
-		// Resolve --from alias if needed
-		var fromOnion string
+		// Load contacts for --from and for alias resolution in display
+		contacts, _ := identity.LoadContacts()
 		if inboxFrom != "" {
-			contacts, _ := identity.LoadContacts()
-			fromOnion = contacts.Resolve(inboxFrom)
+			q.Peer = contacts.Resolve(inboxFrom)
 		}
-
-		// Filter by sender
-		if fromOnion != "" {
-			var filtered []*message.Envelope
-			for _, env := range envelopes {
-				if env.From == fromOnion {
-					filtered = append(filtered, env)
-				}
-			}
-			envelopes = filtered
+		envelopes, err := st.Messages(message.MailboxInbox, q)
+		if err != nil {
+			return err
 		}
-
-		// Apply --last
-		if inboxLast > 0 && len(envelopes) > inboxLast {
-			envelopes = envelopes[len(envelopes)-inboxLast:]
+		states, err := st.States()
+		if err != nil {
+			return err
 		}
 
 		if len(envelopes) == 0 {
-			fmt.Println("No matching messages.")
+			if q.Peer != "" || q.Unread || q.Label != "" || inboxFilters.set() {
+				fmt.Println("No matching messages.")
+			} else {
+				fmt.Println("Inbox is empty.")
+			}
 			return nil
 		}
 
-		// Load contacts for alias resolution in display
-		contacts, _ := identity.LoadContacts()
-
 		for _, env := range envelopes {
+			state := message.StateOf(states, env)
 			if inboxJSON {
-				data, _ := json.Marshal(env)
+				data, err := marshalWithState(env, state)
+				if err != nil {
+					return err
+				}
 				fmt.Println(string(data))
 			} else {
 				ts := time.Unix(env.Ts, 0).Format("2006-01-02 15:04:05")
@@ -87,33 +105,298 @@ var inboxCmd = &cobra.Command{
 				} else if len(sender) > 16 {
 					sender = sender[:16] + "..."
 				}
-				fmt.Printf("[%s] %s: %s\n", ts, sender, env.Body)
+				mark := " "
+				if !state.Read {
+					mark = "*"
+				}
+				id := env.ID
+				if len(id) > 8 {
+					id = id[:8]
+				}
+				var tags string
+				if state.Archived {
+					tags += " (archived)"
+				}
+				if len(state.Labels) > 0 {
+					tags += " [" + strings.Join(state.Labels, ",") + "]"
+				}
+				fmt.Printf("%s %s [%s] %s: %s%s\n", mark, id, ts, sender, env.Body, tags)
+			}
+		}
+		return nil
+	},
+}
+
+var inboxMarkReadCmd = &cobra.Command{
+	Use:   "mark-read <msg-id|--all>",
+	Short: "Mark messages read and send their senders read receipts",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if inboxMarkReadAll {
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.ExactArgs(1)(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hollerDir, err := identity.HollerDir()
+		if err != nil {
+			return err
+		}
+		st, err := message.OpenStore(hollerDir)
+		if err != nil {
+			return err
+		}
+		if inboxMarkReadAll {
+			return markAllRead(hollerDir, st)
+		}
+
+		env, err := findInboxMessage(st, args[0])
+		if err != nil {
+			return err
+		}
+		wasRead := false
+		err = st.UpdateStates([]*message.Envelope{env}, func(s *message.MessageState) {
+			wasRead = s.Read
+			s.Read = true
+		})
+		if err != nil {
+			return err
+		}
+		if wasRead {
+			fmt.Printf("%s was already read\n", env.ID)
+			return nil
+		}
+		fmt.Printf("Marked %s read\n", env.ID)
+		if !message.WantsReceipts(env.Type) {
+			return nil
+		}
+
+		tr, err := loadTransport()
+		if err != nil {
+			return err
+		}
+		if err := tr.CheckDial(); err != nil {
+			return err
+		}
+		rs, err := newReceiptSender(tr, hollerDir)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer cancel()
+		delivered, err := rs.send(ctx, message.ReceiptRead, env)
+		if err != nil {
+			return err
+		}
+		if delivered {
+			fmt.Fprintf(os.Stderr, "Read receipt sent to %s.onion\n", env.From[:16])
+		} else {
+			printOutboxHint(hollerDir)
+		}
+		return nil
+	},
+}
+
+// markAllRead marks every unread message read and sends the read receipts
+// through the outbox, so each sender is dialled once however many of its
+// messages were waiting.
+func markAllRead(hollerDir string, st message.Store) error {
+	unread, err := st.Messages(message.MailboxInbox, message.Query{Unread: true})
+	if err != nil {
+		return err
+	}
+	if len(unread) == 0 {
+		fmt.Println("No unread messages.")
+		return nil
+	}
+	if err := st.UpdateStates(unread, func(s *message.MessageState) { s.Read = true }); err != nil {
+		return err
+	}
+	fmt.Printf("Marked %d message(s) read\n", len(unread))
+
+	tr, err := loadTransport()
+	if err != nil {
+		return err
+	}
+	rs, err := newReceiptSender(tr, hollerDir)
+	if err != nil {
+		return err
+	}
+	receipts := make(map[string]bool)
+	for _, env := range unread {
+		if !message.WantsReceipts(env.Type) {
+			continue
+		}
+		receipt, err := rs.sign(message.ReceiptRead, env)
+		if err != nil {
+			return err
+		}
+		if err := st.Enqueue(message.NewOutboxEntry(receipt, nil)); err != nil {
+			return err
+		}
+		receipts[receipt.ID] = true
+	}
+	if len(receipts) == 0 {
+		return nil
+	}
+	if err := tr.CheckDial(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		printOutboxHint(hollerDir)
+		return nil
+	}
+
+	entries, err := st.Outbox()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	jobs := deliverOutbox(ctx, tr, hollerDir, entries, func(entry message.OutboxEntry) bool {
+		return receipts[entry.Envelope.ID]
+	})
+	delivered := 0
+	for _, job := range jobs {
+		if job.delivered {
+			delivered++
+		}
+	}
+	if err := saveOutbox(st, jobs); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Sent %d read receipt(s)\n", delivered)
+	if delivered < len(jobs) {
+		printOutboxHint(hollerDir)
+	}
+	return nil
+}
+
+var inboxArchiveCmd = &cobra.Command{
+	Use:   "archive <msg-id>",
+	Short: "Hide a message from the inbox listing",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hollerDir, err := identity.HollerDir()
+		if err != nil {
+			return err
+		}
+		st, err := message.OpenStore(hollerDir)
+		if err != nil {
+			return err
+		}
+		env, err := findInboxMessage(st, args[0])
+		if err != nil {
+			return err
+		}
+		err = st.UpdateStates([]*message.Envelope{env}, func(s *message.MessageState) {
+			s.Archived = !inboxArchiveUndo
+		})
+		if err != nil {
+			return err
+		}
+		if inboxArchiveUndo {
+			fmt.Printf("Unarchived %s\n", env.ID)
+		} else {
+			fmt.Printf("Archived %s\n", env.ID)
+		}
+		return nil
+	},
+}
+
+var inboxLabelCmd = &cobra.Command{
+	Use:   "label <msg-id> <label>",
+	Short: "Add a label to a message",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		label := args[1]
+		if label == "" || strings.ContainsAny(label, ", \t\n") {
+			return fmt.Errorf("invalid label %q: must be non-empty, without spaces or commas", label)
+		}
+		hollerDir, err := identity.HollerDir()
+		if err != nil {
+			return err
+		}
+		st, err := message.OpenStore(hollerDir)
+		if err != nil {
+			return err
+		}
+		env, err := findInboxMessage(st, args[0])
+		if err != nil {
+			return err
+		}
+		changed := false
+		err = st.UpdateStates([]*message.Envelope{env}, func(s *message.MessageState) {
+			if inboxLabelRm {
+				changed = s.RemoveLabel(label)
+			} else {
+				changed = s.AddLabel(label)
 			}
+		})
+		if err != nil {
+			return err
+		}
+		switch {
+		case inboxLabelRm && changed:
+			fmt.Printf("Removed label %q from %s\n", label, env.ID)
+		case inboxLabelRm:
+			fmt.Printf("%s has no label %q\n", env.ID, label)
+		case changed:
+			fmt.Printf("Labelled %s %q\n", env.ID, label)
+		default:
+			fmt.Printf("%s already has label %q\n", env.ID, label)
 		}
 		return nil
 	},
 }
 
-func loadInbox(hollerDir string) ([]*message.Envelope, error) {
-	path := message.InboxPath(hollerDir)
-	f, err := os.Open(path)
-	if os.IsNotExist(err) {
-		return nil, nil
+// marshalWithState returns env as JSON with its inbox state appended as a
+// "state" field.
+func marshalWithState(env *message.Envelope, state message.MessageState) ([]byte, error) {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+	return appendJSONField(data, "state", state)
+}
+
+// appendJSONField adds key: v to the end of the JSON object in data, keeping
+// the order of the fields already there.
+func appendJSONField(data []byte, key string, v any) ([]byte, error) {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
 	}
+	k, _ := json.Marshal(key)
+	data = append(data[:len(data)-1], ',')
+	data = append(data, k...)
+	data = append(data, ':')
+	data = append(data, value...)
+	return append(data, '}'), nil
+}
+
+// findInboxMessage looks up an inbox message by full ID or unique ID prefix.
+func findInboxMessage(st message.Store, id string) (*message.Envelope, error) {
+	envelopes, err := st.Messages(message.MailboxInbox, message.Query{ID: id})
 	if err != nil {
-		return nil, fmt.Errorf("open inbox: %w", err)
+		return nil, err
 	}
-	defer f.Close()
+	return findEnvelope(envelopes, id)
+}
 
-	var envelopes []*message.Envelope
-	scanner := bufio.NewScanner(f)
-	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20) // up to 1MB per line
-	for scanner.Scan() {
-		var env message.Envelope
-		if err := json.Unmarshal(scanner.Bytes(), &env); err != nil {
-			continue // skip corrupt lines
+// findEnvelope looks up a message by full ID or unique ID prefix.
+func findEnvelope(envelopes []*message.Envelope, id string) (*message.Envelope, error) {
+	var match *message.Envelope
+	for _, env := range envelopes {
+		if env.ID == id {
+			return env, nil
+		}
+		if strings.HasPrefix(env.ID, id) {
+			if match != nil {
+				return nil, fmt.Errorf("message ID prefix %q is ambiguous", id)
+			}
+			match = env
 		}
-		envelopes = append(envelopes, &env)
 	}
-	return envelopes, scanner.Err()
+	if match == nil {
+		return nil, fmt.Errorf("no message with ID %q", id)
+	}
+	return match, nil
 }
@@ -37,7 +37,11 @@ var listenCmd = &cobra.Command{
 		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 		defer cancel()
 
-		if err := node.CheckTorAvailable(); err != nil {
+		tr, err := loadTransport()
+		if err != nil {
+			return err
+		}
+		if err := tr.CheckListen(); err != nil {
 			return err
 		}
 		onionKey, err := node.LoadOrCreateOnionKey(hollerDir)
@@ -45,21 +49,26 @@ var listenCmd = &cobra.Command{
 			return err
 		}
 		onionAddr := identity.OnionAddrFromKey(onionKey)
-		kp := identity.OnionKeyPairFromBine(onionKey)
 
 		// Message handler
-		msgHandler := func(env *message.Envelope) {
-			data, err := json.Marshal(env)
-			if err != nil {
-				return
+		msgHandler := func(env *message.Envelope) error {
+			isReceipt, err := storeEnvelope(hollerDir, env)
+			if err != nil || isReceipt {
+				return err
 			}
-			message.AppendToInbox(hollerDir, data)
 			if !listenDaemon {
+				data, _ := json.Marshal(env)
 				fmt.Println(string(data))
 			}
+			return nil
+		}
+
+		recv, err := node.NewReceiver(hollerDir, onionAddr, identity.OnionKeyPairFromBine(onionKey), msgHandler)
+		if err != nil {
+			return err
 		}
 
-		tn, err := node.ListenTor(onionKey, onionAddr)
+		tn, err := tr.Listen(onionKey, onionAddr)
 		if err != nil {
 			return err
 		}
@@ -67,11 +76,15 @@ var listenCmd = &cobra.Command{
 
 		fmt.Fprintf(os.Stderr, "Listening as %s.onion:9000\n", onionAddr)
 		if listenDaemon {
-			fmt.Fprintf(os.Stderr, "Daemon mode: writing to %s\n", message.InboxPath(hollerDir))
+			inboxPath := message.InboxPath(hollerDir)
+			if backend, _ := message.StoreBackend(hollerDir); backend == message.BackendBolt {
+				inboxPath = message.BoltPath(hollerDir)
+			}
+			fmt.Fprintf(os.Stderr, "Daemon mode: writing to %s\n", inboxPath)
 		}
 
 		// Start message handler
-		go node.HandleTorConnections(ctx, tn, kp, msgHandler)
+		go recv.Serve(ctx, tn)
 
 		// Start homepage
 		profile := node.LoadProfile(hollerDir)
@@ -84,7 +97,7 @@ var listenCmd = &cobra.Command{
 		fmt.Fprintf(os.Stderr, "Homepage: http://%s.onion\n", onionAddr)
 
 		// Start outbox retry
-		go retryOutboxLoop(ctx, hollerDir)
+		go retryOutboxLoop(ctx, tr, hollerDir)
 
 		<-ctx.Done()
 		fmt.Fprintf(os.Stderr, "\nShutting down...\n")
@@ -92,7 +105,7 @@ var listenCmd = &cobra.Command{
 	},
 }
 
-func retryOutboxLoop(ctx context.Context, hollerDir string) {
+func retryOutboxLoop(ctx context.Context, tr node.Transport, hollerDir string) {
 	ticker := time.NewTicker(60 * time.Second)
 	defer ticker.Stop()
 
@@ -101,72 +114,7 @@ func retryOutboxLoop(ctx context.Context, hollerDir string) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			processOutbox(ctx, hollerDir)
-		}
-	}
-}
-
-func processOutbox(ctx context.Context, hollerDir string) {
-	entries, err := message.LoadOutbox(hollerDir)
-	if err != nil || len(entries) == 0 {
-		return
-	}
-
-	now := time.Now().Unix()
-	var remaining []message.OutboxEntry
-	delivered := 0
-
-	for _, entry := range entries {
-		if entry.NextRetry > now {
-			remaining = append(remaining, entry)
-			continue
+			processOutbox(ctx, tr, hollerDir)
 		}
-		if entry.Attempts >= message.MaxRetries {
-			fmt.Fprintf(os.Stderr, "outbox: giving up on message %s after %d attempts\n", entry.Envelope.ID, entry.Attempts)
-			continue
-		}
-
-		toOnion := entry.Envelope.To
-		if len(toOnion) != 56 {
-			entry.Attempts++
-			entry.NextRetry = time.Now().Add(message.NextBackoff(entry.Attempts)).Unix()
-			remaining = append(remaining, entry)
-			continue
-		}
-
-		if err := deliverOutboxEntry(ctx, toOnion, entry.Envelope); err != nil {
-			entry.Attempts++
-			entry.NextRetry = time.Now().Add(message.NextBackoff(entry.Attempts)).Unix()
-			remaining = append(remaining, entry)
-			continue
-		}
-
-		delivered++
-		fmt.Fprintf(os.Stderr, "outbox: delivered message %s to %s.onion\n", entry.Envelope.ID, toOnion[:16])
-	}
-
-	if delivered > 0 {
-		fmt.Fprintf(os.Stderr, "outbox: delivered %d pending message(s)\n", delivered)
-	}
-	if err := message.WriteOutbox(hollerDir, remaining); err != nil {
-		fmt.Fprintf(os.Stderr, "outbox: failed to write: %v\n", err)
-	}
-}
-
-func deliverOutboxEntry(ctx context.Context, toOnion string, env *message.Envelope) error {
-	connectCtx, connectCancel := context.WithTimeout(ctx, 120*time.Second)
-	defer connectCancel()
-
-	conn, err := node.DialTor(connectCtx, toOnion, 9000)
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
-
-	if err := node.SendTor(conn, env); err != nil {
-		return err
 	}
-	// Wait for ack (best effort)
-	node.RecvTor(conn)
-	return nil
 }
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/1F47E/holler/daemon"
+	"github.com/1F47E/holler/identity"
+	"github.com/1F47E/holler/message"
+	"github.com/spf13/cobra"
+)
+
+var migrateStoreTo string
+
+func init() {
+	migrateStoreCmd.Flags().StringVar(&migrateStoreTo, "to", message.BackendBolt, "Target backend: bolt or jsonl")
+	rootCmd.AddCommand(migrateStoreCmd)
+}
+
+var migrateStoreCmd = &cobra.Command{
+	Use:   "migrate-store",
+	Short: "Convert the inbox, sent log and outbox to another storage backend",
+	Long: `Convert the inbox, sent log and outbox to another storage backend.
+
+bolt keeps them in holler.db, an embedded database indexed by message ID,
+peer, thread, type and time. jsonl keeps them in inbox.jsonl, sent.jsonl and
+outbox.jsonl, with read, archived and label state in inbox_state.json, which
+other tools can read directly. The old files are kept
+with a .bak suffix. Stop the daemon and any 'holler listen' first.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hollerDir, err := identity.HollerDir()
+		if err != nil {
+			return err
+		}
+		if running, pid, _ := daemon.IsRunning(hollerDir); running {
+			return fmt.Errorf("daemon is running (PID %d) — stop it first with 'holler daemon stop'", pid)
+		}
+		counts, err := message.MigrateStore(hollerDir, migrateStoreTo)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Migrated to %s: %d inbox, %d sent, %d outbox\n", migrateStoreTo, counts.Inbox, counts.Sent, counts.Outbox)
+		return nil
+	},
+}
@@ -1,18 +1,36 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"os/signal"
 	"time"
 
 	"github.com/1F47E/holler/identity"
 	"github.com/1F47E/holler/message"
+	"github.com/1F47E/holler/node"
 	"github.com/spf13/cobra"
 )
 
+var (
+	outboxRetryAll  bool
+	outboxRetryTo   string
+	outboxRmTo      string
+	outboxRequeueTo string
+)
+
 func init() {
 	outboxCmd.AddCommand(outboxClearCmd)
+	outboxCmd.AddCommand(outboxDeadCmd)
+	outboxRequeueCmd.Flags().StringVar(&outboxRequeueTo, "to", "", "Recipient (alias or onion address), for an ID dead-lettered for several peers")
+	outboxCmd.AddCommand(outboxRequeueCmd)
+	outboxRetryCmd.Flags().BoolVar(&outboxRetryAll, "all", false, "Retry every pending message")
+	outboxRetryCmd.Flags().StringVar(&outboxRetryTo, "to", "", "Recipient (alias or onion address), for an ID queued to several peers")
+	outboxCmd.AddCommand(outboxRetryCmd)
+	outboxRmCmd.Flags().StringVar(&outboxRmTo, "to", "", "Recipient (alias or onion address), for an ID queued to several peers")
+	outboxCmd.AddCommand(outboxRmCmd)
 	rootCmd.AddCommand(outboxCmd)
 }
 
@@ -24,7 +42,11 @@ var outboxCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		entries, err := message.LoadOutbox(hollerDir)
+		st, err := message.OpenStore(hollerDir)
+		if err != nil {
+			return err
+		}
+		entries, err := st.Outbox()
 		if err != nil {
 			return err
 		}
@@ -41,6 +63,12 @@ var outboxCmd = &cobra.Command{
 				"attempts":   entry.Attempts,
 				"next_retry": time.Unix(entry.NextRetry, 0).Format(time.RFC3339),
 			}
+			if entry.LastAttempt > 0 {
+				info["last_attempt"] = time.Unix(entry.LastAttempt, 0).Format(time.RFC3339)
+			}
+			if entry.LastError != "" {
+				info["last_error"] = entry.LastError
+			}
 			data, _ := json.Marshal(info)
 			fmt.Println(string(data))
 		}
@@ -56,11 +84,253 @@ var outboxClearCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		path := message.OutboxPath(hollerDir)
-		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		st, err := message.OpenStore(hollerDir)
+		if err != nil {
+			return err
+		}
+		err = st.UpdateOutbox(func([]message.OutboxEntry) ([]message.OutboxEntry, error) {
+			return nil, nil
+		})
+		if err != nil {
 			return fmt.Errorf("clear outbox: %w", err)
 		}
 		fmt.Println("Outbox cleared.")
 		return nil
 	},
 }
+
+var outboxDeadCmd = &cobra.Command{
+	Use:   "dead",
+	Short: "List messages that could not be delivered",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hollerDir, err := identity.HollerDir()
+		if err != nil {
+			return err
+		}
+		letters, err := message.LoadDeadLetters(hollerDir)
+		if err != nil {
+			return err
+		}
+		if len(letters) == 0 {
+			fmt.Println("No dead letters.")
+			return nil
+		}
+		fmt.Fprintf(os.Stderr, "%d undeliverable message(s):\n", len(letters))
+		for _, dl := range letters {
+			info := map[string]interface{}{
+				"id":       dl.Envelope.ID,
+				"to":       dl.Envelope.To,
+				"body":     dl.Envelope.Body,
+				"attempts": dl.Attempts,
+				"reason":   dl.Reason,
+				"failed":   time.Unix(dl.Failed, 0).Format(time.RFC3339),
+			}
+			data, _ := json.Marshal(info)
+			fmt.Println(string(data))
+		}
+		return nil
+	},
+}
+
+var outboxRequeueCmd = &cobra.Command{
+	Use:   "requeue <msg-id>",
+	Short: "Move a dead letter back to the outbox for another round of retries",
+	Long: `Move a dead letter back to the outbox. The message keeps its ID but gets a
+fresh timestamp and signature, so the recipient doesn't refuse it as too old.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hollerDir, err := identity.HollerDir()
+		if err != nil {
+			return err
+		}
+		onionKey, err := node.LoadOrCreateOnionKey(hollerDir)
+		if err != nil {
+			return err
+		}
+
+		var env *message.Envelope
+		err = message.UpdateDeadLetters(hollerDir, func(letters []message.DeadLetter) ([]message.DeadLetter, error) {
+			envs := make([]*message.Envelope, len(letters))
+			for i, dl := range letters {
+				envs[i] = dl.Envelope
+			}
+			var err error
+			if env, err = findQueued(envs, args[0], outboxRequeueTo); err != nil {
+				return nil, err
+			}
+
+			env.Ts = time.Now().Unix()
+			env.PoW = ""
+			if err := env.Sign(identity.OnionKeyPairFromBine(onionKey)); err != nil {
+				return nil, fmt.Errorf("sign message: %w", err)
+			}
+			if err := enqueue(hollerDir, env, nil); err != nil {
+				return nil, err
+			}
+
+			var rest []message.DeadLetter
+			for _, dl := range letters {
+				if keyOf(dl.Envelope) != keyOf(env) {
+					rest = append(rest, dl)
+				}
+			}
+			return rest, nil
+		})
+		if err != nil {
+			return err
+		}
+		trackDelivery(hollerDir, env, message.DeliveryQueued, 0, nil, nil)
+		fmt.Printf("Requeued %s\n", env.ID)
+		printOutboxHint(hollerDir)
+		return nil
+	},
+}
+
+var outboxRetryCmd = &cobra.Command{
+	Use:   "retry <msg-id|--all>",
+	Short: "Attempt delivery now instead of waiting for the next retry",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if outboxRetryAll == (len(args) == 1) {
+			return fmt.Errorf("give a message ID or --all")
+		}
+		hollerDir, err := identity.HollerDir()
+		if err != nil {
+			return err
+		}
+		st, err := message.OpenStore(hollerDir)
+		if err != nil {
+			return err
+		}
+		entries, err := st.Outbox()
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			fmt.Println("Outbox is empty.")
+			return nil
+		}
+
+		var target *message.Envelope
+		if !outboxRetryAll {
+			if target, err = findOutboxEntry(entries, args[0], outboxRetryTo); err != nil {
+				return err
+			}
+		}
+
+		tr, err := loadTransport()
+		if err != nil {
+			return err
+		}
+		if err := tr.CheckDial(); err != nil {
+			return err
+		}
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer cancel()
+
+		jobs := deliverOutbox(ctx, tr, hollerDir, entries, func(entry message.OutboxEntry) bool {
+			return target == nil || keyOf(entry.Envelope) == keyOf(target)
+		})
+		delivered, failed := 0, 0
+		for _, job := range jobs {
+			switch {
+			case job.delivered:
+				delivered++
+			case job.keep:
+				failed++
+				fmt.Fprintf(os.Stderr, "outbox: %s still pending: %s\n", job.entry.Envelope.ID, job.entry.LastError)
+			default:
+				failed++
+			}
+		}
+		if err := saveOutbox(st, jobs); err != nil {
+			return err
+		}
+		fmt.Printf("Delivered %d, failed %d\n", delivered, failed)
+		return nil
+	},
+}
+
+var outboxRmCmd = &cobra.Command{
+	Use:   "rm <msg-id>",
+	Short: "Cancel a pending message",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hollerDir, err := identity.HollerDir()
+		if err != nil {
+			return err
+		}
+		st, err := message.OpenStore(hollerDir)
+		if err != nil {
+			return err
+		}
+		var env *message.Envelope
+		err = st.UpdateOutbox(func(entries []message.OutboxEntry) ([]message.OutboxEntry, error) {
+			var err error
+			if env, err = findOutboxEntry(entries, args[0], outboxRmTo); err != nil {
+				return nil, err
+			}
+			var remaining []message.OutboxEntry
+			for _, entry := range entries {
+				if keyOf(entry.Envelope) != keyOf(env) {
+					remaining = append(remaining, entry)
+				}
+			}
+			return remaining, nil
+		})
+		if err != nil {
+			return err
+		}
+		trackDelivery(hollerDir, env, message.DeliveryCancelled, 0, nil, nil)
+		fmt.Printf("Removed %s from outbox\n", env.ID)
+		return nil
+	},
+}
+
+// enqueue adds env to the outbox after a failed delivery. lastErr, if not
+// nil, is why it failed.
+func enqueue(hollerDir string, env *message.Envelope, lastErr error) error {
+	st, err := message.OpenStore(hollerDir)
+	if err != nil {
+		return err
+	}
+	return st.Enqueue(message.NewOutboxEntry(env, lastErr))
+}
+
+// findOutboxEntry looks up a pending message by full ID or unique ID prefix,
+// and recipient if to is set.
+func findOutboxEntry(entries []message.OutboxEntry, id, to string) (*message.Envelope, error) {
+	envs := make([]*message.Envelope, len(entries))
+	for i, entry := range entries {
+		envs[i] = entry.Envelope
+	}
+	return findQueued(envs, id, to)
+}
+
+// findQueued looks up a queued or dead-lettered message by full ID or unique
+// ID prefix. A caller-supplied ID can be queued to several peers; to, an
+// alias or onion address, picks one, and without it such an ID is refused
+// rather than acting on whichever copy comes first.
+func findQueued(envs []*message.Envelope, id, to string) (*message.Envelope, error) {
+	if to != "" {
+		contacts, _ := identity.LoadContacts()
+		onion := contacts.Resolve(to)
+		var forPeer []*message.Envelope
+		for _, env := range envs {
+			if env.To == onion {
+				forPeer = append(forPeer, env)
+			}
+		}
+		envs = forPeer
+	}
+	env, err := findEnvelope(envs, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, other := range envs {
+		if other.ID == env.ID && other.To != env.To {
+			return nil, fmt.Errorf("message %s was sent to several peers; pick one with --to", env.ID)
+		}
+	}
+	return env, nil
+}
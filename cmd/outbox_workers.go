@@ -0,0 +1,295 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	bineed25519 "github.com/cretz/bine/torutil/ed25519"
+
+	"github.com/1F47E/holler/daemon"
+	"github.com/1F47E/holler/identity"
+	"github.com/1F47E/holler/message"
+	"github.com/1F47E/holler/node"
+)
+
+const (
+	// outboxWorkers bounds how many peers the outbox delivers to at once.
+	outboxWorkers = 8
+	// outboxAttemptTimeout bounds connecting to a peer, and each delivery
+	// made over the connection.
+	outboxAttemptTimeout = 120 * time.Second
+)
+
+// outboxJob is one outbox entry picked for a delivery attempt, and its outcome.
+type outboxJob struct {
+	entry     *message.OutboxEntry
+	delivered bool
+	keep      bool // still queued afterwards
+}
+
+func processOutbox(ctx context.Context, tr node.Transport, hollerDir string) {
+	st, err := message.OpenStore(hollerDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "outbox: %v\n", err)
+		return
+	}
+	entries, err := st.Outbox()
+	if err != nil || len(entries) == 0 {
+		return
+	}
+
+	now := time.Now().Unix()
+	jobs := deliverOutbox(ctx, tr, hollerDir, entries, func(entry message.OutboxEntry) bool {
+		return entry.NextRetry <= now || entryExpired(entry)
+	})
+
+	delivered := 0
+	for _, job := range jobs {
+		if job.delivered {
+			delivered++
+		}
+	}
+	if delivered > 0 {
+		fmt.Fprintf(os.Stderr, "outbox: delivered %d pending message(s)\n", delivered)
+	}
+	if err := saveOutbox(st, jobs); err != nil {
+		fmt.Fprintf(os.Stderr, "outbox: failed to write: %v\n", err)
+	}
+}
+
+// deliverOutbox attempts the entries picked by due, updating them in place,
+// and returns a job for each one picked. Each recipient gets its own worker,
+// at most outboxWorkers of them at a time, so an unreachable peer only holds
+// up its own messages.
+func deliverOutbox(ctx context.Context, tr node.Transport, hollerDir string, entries []message.OutboxEntry, due func(message.OutboxEntry) bool) []*outboxJob {
+	onionKey, err := node.LoadOrCreateOnionKey(hollerDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "outbox: %v\n", err)
+		return nil
+	}
+	kp := identity.OnionKeyPairFromBine(onionKey)
+
+	var jobs []*outboxJob
+	var peers []string
+	queues := make(map[string][]*outboxJob)
+	for i := range entries {
+		if !due(entries[i]) {
+			continue
+		}
+		job := &outboxJob{entry: &entries[i], keep: true}
+		jobs = append(jobs, job)
+		to := entries[i].Envelope.To
+		if _, ok := queues[to]; !ok {
+			peers = append(peers, to)
+		}
+		queues[to] = append(queues[to], job)
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, outboxWorkers)
+	for _, to := range peers {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(to string, queue []*outboxJob) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			deliverToPeer(ctx, tr, kp, hollerDir, to, queue)
+		}(to, queues[to])
+	}
+	wg.Wait()
+	return jobs
+}
+
+// deliverToPeer works through one recipient's queue in order over a single
+// connection. Once the peer can't be reached, or a message to it fails, that
+// message is retried later as usual and the rest of the queue is deferred
+// rather than dialling again or delivering later messages ahead of it.
+func deliverToPeer(ctx context.Context, tr node.Transport, kp bineed25519.KeyPair, hollerDir, to string, queue []*outboxJob) {
+	var c *node.Client
+	defer func() {
+		if c != nil {
+			c.Close()
+		}
+	}()
+
+	var deferErr error // why the rest of the queue is held
+	var heldUntil int64
+	deferred := 0
+	for _, job := range queue {
+		if retired, err := retireEntry(hollerDir, job.entry); retired {
+			job.keep = err != nil
+			continue
+		}
+		if deferErr != nil {
+			// Never tried, so this costs no attempt and isn't recorded:
+			// the entry just waits for the one ahead of it.
+			job.entry.NextRetry = heldUntil
+			deferred++
+			continue
+		}
+
+		var reply *message.Envelope
+		var err error
+		switch {
+		case !identity.ValidOnionAddr(to):
+			err = fmt.Errorf("invalid recipient %q", to)
+		case c == nil:
+			c, err = connectPeer(ctx, tr, to)
+		}
+		if err == nil {
+			reply, err = deliverOutboxEntry(ctx, c, kp, job.entry.Envelope)
+		}
+		job.delivered, job.keep = settleEntry(hollerDir, job.entry, reply, err)
+		if job.keep {
+			deferErr = fmt.Errorf("held behind %s: %w", job.entry.Envelope.ID, err)
+			heldUntil = job.entry.NextRetry
+		}
+	}
+	if deferred > 0 {
+		fmt.Fprintf(os.Stderr, "outbox: deferred %d message(s) to %s: %v\n", deferred, shortPeer(identity.Contacts{}, to), deferErr)
+	}
+}
+
+// outboxKey identifies a queued message. Caller-supplied IDs repeat across
+// peers, so the ID alone doesn't.
+type outboxKey struct {
+	to, id string
+}
+
+func keyOf(env *message.Envelope) outboxKey {
+	return outboxKey{env.To, env.ID}
+}
+
+// saveOutbox writes the outcome of jobs back to the outbox: delivered and
+// dead-lettered entries are dropped, the rest updated. Entries queued or
+// removed while the attempts were in flight are left as they are.
+func saveOutbox(st message.Store, jobs []*outboxJob) error {
+	results := make(map[outboxKey]*outboxJob, len(jobs))
+	for _, job := range jobs {
+		results[keyOf(job.entry.Envelope)] = job
+	}
+	return st.UpdateOutbox(func(current []message.OutboxEntry) ([]message.OutboxEntry, error) {
+		var merged []message.OutboxEntry
+		for _, entry := range current {
+			job, ok := results[keyOf(entry.Envelope)]
+			switch {
+			case !ok:
+				merged = append(merged, entry)
+			case job.keep:
+				merged = append(merged, *job.entry)
+			}
+		}
+		return merged, nil
+	})
+}
+
+// connectPeer opens a client connection to addr for a round of deliveries.
+func connectPeer(ctx context.Context, tr node.Transport, addr string) (*node.Client, error) {
+	connectCtx, cancel := context.WithTimeout(ctx, outboxAttemptTimeout)
+	defer cancel()
+	return node.Connect(connectCtx, tr, addr)
+}
+
+// entryExpired reports whether an outbox message is too old to deliver.
+func entryExpired(entry message.OutboxEntry) bool {
+	return time.Since(time.Unix(entry.Envelope.Ts, 0)) > message.OutboxTTL
+}
+
+// retireEntry moves an expired entry, or one out of retries, to the
+// dead-letter queue instead of attempting it. It reports whether the entry
+// was retired, and any error writing the dead letter, in which case the
+// entry must stay in the outbox.
+func retireEntry(hollerDir string, entry *message.OutboxEntry) (bool, error) {
+	env := entry.Envelope
+	// The direct send in `holler send` was attempt 1.
+	attempts := entry.Attempts + 1
+	if entryExpired(*entry) {
+		fmt.Fprintf(os.Stderr, "outbox: message %s expired after %s undelivered\n", env.ID, message.OutboxTTL)
+		return true, buryEntry(hollerDir, env, message.DeliveryExpired, attempts, fmt.Errorf("undelivered after %s", message.OutboxTTL), nil)
+	}
+	if entry.Attempts >= message.MaxRetries {
+		fmt.Fprintf(os.Stderr, "outbox: giving up on message %s after %d attempts\n", env.ID, attempts)
+		return true, buryEntry(hollerDir, env, message.DeliveryFailed, attempts, fmt.Errorf("gave up after %d attempts", attempts), nil)
+	}
+	return false, nil
+}
+
+// settleEntry records the outcome of one delivery attempt for an outbox
+// entry. It reports whether the message was delivered and whether the
+// entry stays queued.
+func settleEntry(hollerDir string, entry *message.OutboxEntry, reply *message.Envelope, err error) (delivered, keep bool) {
+	env := entry.Envelope
+	attempt := entry.Attempts + 2
+	entry.LastAttempt = time.Now().Unix()
+	if err != nil {
+		var nack *nackError
+		if errors.As(err, &nack) && nack.permanent() {
+			if berr := buryEntry(hollerDir, env, message.DeliveryFailed, attempt, err, reply); berr != nil {
+				entry.LastError = err.Error()
+				return false, true
+			}
+			fmt.Fprintf(os.Stderr, "outbox: message %s rejected by %s.onion: %v — moved to dead letters\n", env.ID, env.To[:16], nack)
+			return false, false
+		}
+		trackDelivery(hollerDir, env, message.DeliveryAttempt, attempt, err, nil)
+		entry.Attempts++
+		entry.NextRetry = time.Now().Add(message.NextBackoff(entry.Attempts)).Unix()
+		entry.LastError = err.Error()
+		return false, true
+	}
+
+	recordReply(hollerDir, reply)
+	recordSent(hollerDir, env)
+	trackDelivery(hollerDir, env, message.DeliveryDelivered, attempt, nil, reply)
+	fmt.Fprintf(os.Stderr, "outbox: delivered message %s to %s.onion\n", env.ID, env.To[:16])
+	return true, false
+}
+
+// buryEntry gives up on an outbox message: it moves the envelope and its
+// history to the dead-letter queue, records the final lifecycle event and
+// runs the on-fail hook. If the dead letter can't be written nothing is
+// recorded and the error is returned, so the caller keeps the entry queued
+// rather than lose the envelope.
+func buryEntry(hollerDir string, env *message.Envelope, event string, attempts int, reason error, reply *message.Envelope) error {
+	final := message.NewDeliveryEvent(env, event, attempts, reason, reply)
+	dl := message.DeadLetter{
+		Envelope: env,
+		Attempts: attempts,
+		Reason:   reason.Error(),
+		Failed:   time.Now().Unix(),
+	}
+	if events, err := message.LoadDeliveries(hollerDir); err == nil {
+		for _, ev := range events {
+			if ev.ID == env.ID && ev.To == env.To {
+				dl.History = append(dl.History, ev)
+			}
+		}
+	}
+	dl.History = append(dl.History, final)
+	if err := message.AppendToDeadLetter(hollerDir, dl); err != nil {
+		fmt.Fprintf(os.Stderr, "outbox: dead letter %s: %v — keeping it in the outbox\n", env.ID, err)
+		return err
+	}
+	if message.WantsReceipts(env.Type) {
+		if err := message.AppendDelivery(hollerDir, final); err != nil {
+			fmt.Fprintf(os.Stderr, "deliveries: %v\n", err)
+		}
+	}
+	daemon.RunFailHook(hollerDir, dl)
+	return nil
+}
+
+// deliverOutboxEntry makes one delivery attempt over c. Only an ack or
+// receipt counts: without one the entry is retried, and the peer acks a copy
+// it already stored without processing it again.
+func deliverOutboxEntry(ctx context.Context, c *node.Client, kp bineed25519.KeyPair, env *message.Envelope) (*message.Envelope, error) {
+	attemptCtx, cancel := context.WithTimeout(ctx, outboxAttemptTimeout)
+	defer cancel()
+	return deliverOn(attemptCtx, c, kp, env)
+}
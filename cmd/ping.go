@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
@@ -27,7 +28,11 @@ var pingCmd = &cobra.Command{
 		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 		defer cancel()
 
-		if err := node.CheckTorSOCKS(); err != nil {
+		tr, err := loadTransport()
+		if err != nil {
+			return err
+		}
+		if err := tr.CheckDial(); err != nil {
 			return err
 		}
 
@@ -61,27 +66,25 @@ var pingCmd = &cobra.Command{
 		connectCtx, connectCancel := context.WithTimeout(ctx, 120*time.Second)
 		defer connectCancel()
 
-		conn, err := node.DialTor(connectCtx, toOnion, 9000)
+		c, err := node.Connect(connectCtx, tr, toOnion)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Peer %s.onion unreachable: %v\n", toOnion[:16], err)
 			return nil
 		}
-		defer conn.Close()
+		defer c.Close()
 
 		start := time.Now()
-		if err := node.SendTor(conn, env); err != nil {
-			fmt.Fprintf(os.Stderr, "Send failed: %v\n", err)
-			return nil
-		}
-
-		ack, err := node.RecvTor(conn)
-		if err != nil {
+		ack, err := c.Exchange(connectCtx, env)
+		if errors.Is(err, node.ErrNoReply) {
 			fmt.Fprintf(os.Stderr, "No ack: %v\n", err)
 			return nil
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "Send failed: %v\n", err)
+			return nil
 		}
 		rtt := time.Since(start)
 
-		if ack.Type == "ack" {
+		if ack.Type == "ack" || ack.Type == message.ReceiptReceived {
 			if valid, verr := ack.Verify(); verr != nil || !valid {
 				fmt.Fprintf(os.Stderr, "Ack signature invalid\n")
 				return nil
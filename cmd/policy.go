@@ -0,0 +1,263 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/1F47E/holler/identity"
+	"github.com/1F47E/holler/message"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	policyCmd.AddCommand(policyModeCmd)
+	policyCmd.AddCommand(policyBlockCmd)
+	policyCmd.AddCommand(policyUnblockCmd)
+	policyCmd.AddCommand(policyTypesCmd)
+	policyCmd.AddCommand(policyMaxBodyCmd)
+	policyCmd.AddCommand(policyRmCmd)
+	policyCmd.AddCommand(policyPoWCmd)
+	rootCmd.AddCommand(policyCmd)
+}
+
+var policyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "View and edit the sender policy",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		policy, err := identity.LoadPolicy()
+		if err != nil {
+			return err
+		}
+		contacts, err := identity.LoadContacts()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Mode: %s\n", policy.Mode)
+		if policy.PoWDifficulty > 0 {
+			fmt.Printf("Proof-of-work: %d bits for non-contacts\n", policy.PoWDifficulty)
+		}
+		if len(policy.Blocked) > 0 {
+			fmt.Println("\nBlocked:")
+			for _, addr := range policy.Blocked {
+				fmt.Printf("  %s\n", displayOnion(contacts, addr))
+			}
+		}
+		if len(policy.Rules) > 0 {
+			fmt.Println("\nRules:")
+			addrs := make([]string, 0, len(policy.Rules))
+			for addr := range policy.Rules {
+				addrs = append(addrs, addr)
+			}
+			sort.Strings(addrs)
+			for _, addr := range addrs {
+				rule := policy.Rules[addr]
+				types := "any"
+				if len(rule.Types) > 0 {
+					types = strings.Join(rule.Types, ",")
+				}
+				maxBody := "unlimited"
+				if rule.MaxBody > 0 {
+					maxBody = fmt.Sprintf("%d bytes", rule.MaxBody)
+				}
+				fmt.Printf("  %-20s types=%s max-body=%s\n", displayOnion(contacts, addr), types, maxBody)
+			}
+		}
+		return nil
+	},
+}
+
+var policyModeCmd = &cobra.Command{
+	Use:   "mode <open|contacts|quarantine>",
+	Short: "Accept messages from anyone, only from contacts, or quarantine unknown senders",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		mode := args[0]
+		if !identity.ValidPolicyMode(mode) {
+			return fmt.Errorf("invalid mode %q: must be %s, %s or %s", mode, identity.PolicyOpen, identity.PolicyContacts, identity.PolicyQuarantine)
+		}
+		return updatePolicy(func(p *identity.Policy, _ identity.Contacts) error {
+			p.Mode = mode
+			fmt.Printf("Policy mode set to %s\n", mode)
+			return nil
+		})
+	},
+}
+
+var policyBlockCmd = &cobra.Command{
+	Use:   "block <alias|onion-addr>",
+	Short: "Reject all messages from a sender",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updatePolicy(func(p *identity.Policy, contacts identity.Contacts) error {
+			addr, err := resolveOnion(contacts, args[0])
+			if err != nil {
+				return err
+			}
+			if p.Block(addr) {
+				fmt.Printf("Blocked %s\n", displayOnion(contacts, addr))
+			} else {
+				fmt.Printf("%s is already blocked\n", displayOnion(contacts, addr))
+			}
+			return nil
+		})
+	},
+}
+
+var policyUnblockCmd = &cobra.Command{
+	Use:   "unblock <alias|onion-addr>",
+	Short: "Remove a sender from the block list",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updatePolicy(func(p *identity.Policy, contacts identity.Contacts) error {
+			addr, err := resolveOnion(contacts, args[0])
+			if err != nil {
+				return err
+			}
+			if !p.Unblock(addr) {
+				return fmt.Errorf("%s is not blocked", displayOnion(contacts, addr))
+			}
+			fmt.Printf("Unblocked %s\n", displayOnion(contacts, addr))
+			return nil
+		})
+	},
+}
+
+var policyTypesCmd = &cobra.Command{
+	Use:   "types <alias|onion-addr> <type,...|any>",
+	Short: "Restrict which message types a sender may deliver",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updatePolicy(func(p *identity.Policy, contacts identity.Contacts) error {
+			addr, err := resolveOnion(contacts, args[0])
+			if err != nil {
+				return err
+			}
+			var types []string
+			if args[1] != "any" {
+				for _, t := range strings.Split(args[1], ",") {
+					if t = strings.TrimSpace(t); t != "" {
+						types = append(types, t)
+					}
+				}
+			}
+			rule := p.Rules[addr]
+			rule.Types = types
+			setRule(p, addr, rule)
+			fmt.Printf("Types for %s: %s\n", displayOnion(contacts, addr), args[1])
+			return nil
+		})
+	},
+}
+
+var policyMaxBodyCmd = &cobra.Command{
+	Use:   "max-body <alias|onion-addr> <bytes>",
+	Short: "Limit the body size a sender may deliver (0 = no limit)",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid size %q: must be a non-negative number of bytes", args[1])
+		}
+		return updatePolicy(func(p *identity.Policy, contacts identity.Contacts) error {
+			addr, err := resolveOnion(contacts, args[0])
+			if err != nil {
+				return err
+			}
+			rule := p.Rules[addr]
+			rule.MaxBody = n
+			setRule(p, addr, rule)
+			fmt.Printf("Max body for %s: %d\n", displayOnion(contacts, addr), n)
+			return nil
+		})
+	},
+}
+
+var policyRmCmd = &cobra.Command{
+	Use:   "rm <alias|onion-addr>",
+	Short: "Remove the per-sender rule",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updatePolicy(func(p *identity.Policy, contacts identity.Contacts) error {
+			addr, err := resolveOnion(contacts, args[0])
+			if err != nil {
+				return err
+			}
+			if _, ok := p.Rules[addr]; !ok {
+				return fmt.Errorf("no rule for %s", displayOnion(contacts, addr))
+			}
+			delete(p.Rules, addr)
+			fmt.Printf("Removed rule for %s\n", displayOnion(contacts, addr))
+			return nil
+		})
+	},
+}
+
+var policyPoWCmd = &cobra.Command{
+	Use:   "pow <bits>",
+	Short: "Require proof-of-work from senders not in contacts (0 = off)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		bits, err := strconv.Atoi(args[0])
+		if err != nil || bits < 0 || bits > message.MaxPoWBits {
+			return fmt.Errorf("invalid difficulty %q: must be 0-%d bits", args[0], message.MaxPoWBits)
+		}
+		return updatePolicy(func(p *identity.Policy, _ identity.Contacts) error {
+			p.PoWDifficulty = bits
+			if bits == 0 {
+				fmt.Println("Proof-of-work disabled")
+			} else {
+				fmt.Printf("Non-contacts must attach %d bits of proof-of-work\n", bits)
+			}
+			return nil
+		})
+	},
+}
+
+// updatePolicy loads the policy and contacts, applies fn and saves the result.
+func updatePolicy(fn func(p *identity.Policy, contacts identity.Contacts) error) error {
+	policy, err := identity.LoadPolicy()
+	if err != nil {
+		return err
+	}
+	contacts, err := identity.LoadContacts()
+	if err != nil {
+		return err
+	}
+	if err := fn(policy, contacts); err != nil {
+		return err
+	}
+	return identity.SavePolicy(policy)
+}
+
+// setRule stores rule for addr, dropping it when it no longer restricts anything.
+func setRule(p *identity.Policy, addr string, rule identity.Rule) {
+	if len(rule.Types) == 0 && rule.MaxBody == 0 {
+		delete(p.Rules, addr)
+		return
+	}
+	if p.Rules == nil {
+		p.Rules = make(map[string]identity.Rule)
+	}
+	p.Rules[addr] = rule
+}
+
+// resolveOnion resolves an alias or raw onion address, rejecting anything
+// that isn't a valid onion address.
+func resolveOnion(contacts identity.Contacts, aliasOrOnion string) (string, error) {
+	addr := strings.TrimSuffix(contacts.Resolve(aliasOrOnion), ".onion")
+	if !identity.ValidOnionAddr(addr) {
+		return "", fmt.Errorf("cannot resolve %q to a contact or onion address", aliasOrOnion)
+	}
+	return addr, nil
+}
+
+// displayOnion renders an onion address as its alias when one is known.
+func displayOnion(contacts identity.Contacts, addr string) string {
+	if alias, found := contacts.FindByOnion(addr); found {
+		return alias
+	}
+	return addr + ".onion"
+}
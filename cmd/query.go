@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/1F47E/holler/message"
+	"github.com/spf13/cobra"
+)
+
+// queryFlags are the message filters shared by the commands that list
+// messages. They all compose: a message must pass every one given.
+type queryFlags struct {
+	msgType string
+	thread  string
+	replyTo string
+	since   string
+	until   string
+	meta    []string
+}
+
+func (f *queryFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.msgType, "type", "", "Only messages of this type")
+	cmd.Flags().StringVar(&f.thread, "thread", "", "Only messages in this thread")
+	cmd.Flags().StringVar(&f.replyTo, "reply-to", "", "Only replies to this message ID")
+	cmd.Flags().StringVar(&f.since, "since", "", "Only messages at or after this time (duration like 2h or 7d, or date like 2006-01-02)")
+	cmd.Flags().StringVar(&f.until, "until", "", "Only messages before this time (duration or date, as --since)")
+	cmd.Flags().StringSliceVar(&f.meta, "meta", nil, "Only messages with this meta key=value (can be repeated)")
+}
+
+// set reports whether any filter was given.
+func (f *queryFlags) set() bool {
+	return f.msgType != "" || f.thread != "" || f.replyTo != "" || f.since != "" || f.until != "" || len(f.meta) > 0
+}
+
+// query returns a Query holding the filters.
+func (f *queryFlags) query() (message.Query, error) {
+	q := message.Query{Type: f.msgType, ThreadID: f.thread, ReplyTo: f.replyTo}
+	now := time.Now()
+	var err error
+	if f.since != "" {
+		if q.Since, err = parseTime(f.since, now); err != nil {
+			return q, fmt.Errorf("invalid --since: %w", err)
+		}
+	}
+	if f.until != "" {
+		if q.Until, err = parseTime(f.until, now); err != nil {
+			return q, fmt.Errorf("invalid --until: %w", err)
+		}
+	}
+	if q.Meta, err = parseMeta(f.meta); err != nil {
+		return q, err
+	}
+	return q, nil
+}
+
+// timeLayouts are the absolute times --since and --until accept, read in
+// local time.
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseTime reads s as a duration back from now (Go syntax plus d for days
+// and w for weeks, e.g. 90m, 36h, 7d, 2w) or as a date or time, and returns
+// it as unix seconds.
+func parseTime(s string, now time.Time) (int64, error) {
+	if n, unit := s[:len(s)-1], s[len(s)-1]; unit == 'd' || unit == 'w' {
+		if days, err := strconv.Atoi(n); err == nil && days >= 0 {
+			if unit == 'w' {
+				days *= 7
+			}
+			return now.AddDate(0, 0, -days).Unix(), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d).Unix(), nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t.Unix(), nil
+		}
+	}
+	return 0, fmt.Errorf("%q is neither a duration (2h, 7d) nor a date (2006-01-02)", s)
+}
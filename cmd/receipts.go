@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	bineed25519 "github.com/cretz/bine/torutil/ed25519"
+
+	"github.com/1F47E/holler/identity"
+	"github.com/1F47E/holler/message"
+	"github.com/1F47E/holler/node"
+)
+
+// receiptSender signs and delivers processed and read receipts. A receipt
+// that can't be delivered right away waits in the outbox like any message.
+type receiptSender struct {
+	tr      node.Transport
+	dir     string
+	onion   string
+	keyPair bineed25519.KeyPair
+}
+
+func newReceiptSender(tr node.Transport, hollerDir string) (*receiptSender, error) {
+	onionKey, err := node.LoadOrCreateOnionKey(hollerDir)
+	if err != nil {
+		return nil, err
+	}
+	return &receiptSender{
+		tr:      tr,
+		dir:     hollerDir,
+		onion:   identity.OnionAddrFromKey(onionKey),
+		keyPair: identity.OnionKeyPairFromBine(onionKey),
+	}, nil
+}
+
+// sign returns a signed receiptType receipt for orig.
+func (s *receiptSender) sign(receiptType string, orig *message.Envelope) (*message.Envelope, error) {
+	env := message.NewReceipt(s.onion, receiptType, orig)
+	if err := env.Sign(s.keyPair); err != nil {
+		return nil, fmt.Errorf("sign receipt: %w", err)
+	}
+	return env, nil
+}
+
+// send delivers a receiptType receipt for orig to orig's sender. It returns
+// true if the receipt was delivered, false if it was queued in the outbox.
+func (s *receiptSender) send(ctx context.Context, receiptType string, orig *message.Envelope) (bool, error) {
+	env, err := s.sign(receiptType, orig)
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 120*time.Second)
+	defer cancel()
+	_, err = deliver(ctx, s.tr, s.keyPair, env)
+	var nack *nackError
+	switch {
+	case errors.As(err, &nack) && nack.permanent():
+		return false, fmt.Errorf("%s receipt rejected by %s.onion: %v", receiptType, orig.From[:16], nack)
+	case err != nil:
+		if qerr := enqueue(s.dir, env, err); qerr != nil {
+			return false, qerr
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// storeEnvelope files an accepted envelope: receipts for our own messages go
+// to receipts.jsonl, everything else to the inbox. Reports whether it was a
+// receipt.
+func storeEnvelope(hollerDir string, env *message.Envelope) (bool, error) {
+	var err error
+	if message.IsReceipt(env.Type) {
+		var data []byte
+		if data, err = json.Marshal(env); err == nil {
+			err = message.AppendToReceipts(hollerDir, data)
+		}
+	} else {
+		var st message.Store
+		if st, err = message.OpenStore(hollerDir); err == nil {
+			err = st.Append(message.MailboxInbox, env)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "recv: store %s: %v\n", env.ID, err)
+	}
+	return message.IsReceipt(env.Type), err
+}
+
+// recordSent adds a delivered message to the sent log.
+func recordSent(hollerDir string, env *message.Envelope) {
+	if !message.WantsReceipts(env.Type) {
+		return
+	}
+	st, err := message.OpenStore(hollerDir)
+	if err == nil {
+		err = st.Append(message.MailboxSent, env)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sent: %v\n", err)
+	}
+}
+
+// trackDelivery records a lifecycle event for an outgoing message. Receipts
+// and other control traffic aren't tracked.
+func trackDelivery(hollerDir string, env *message.Envelope, event string, attempt int, err error, reply *message.Envelope) {
+	if !message.WantsReceipts(env.Type) {
+		return
+	}
+	if rerr := message.RecordDelivery(hollerDir, env, event, attempt, err, reply); rerr != nil {
+		fmt.Fprintf(os.Stderr, "deliveries: %v\n", rerr)
+	}
+}
+
+// recordReply keeps a synchronous received receipt from a delivery.
+func recordReply(hollerDir string, reply *message.Envelope) {
+	if reply == nil || reply.Type != message.ReceiptReceived {
+		return
+	}
+	if data, err := json.Marshal(reply); err == nil {
+		message.AppendToReceipts(hollerDir, data)
+	}
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/1F47E/holler/identity"
+	"github.com/1F47E/holler/message"
+	"github.com/spf13/cobra"
+)
+
+var (
+	replyStdin    bool
+	replyType     string
+	replyMeta     []string
+	replyCopyMeta []string
+	replyID       string
+)
+
+func init() {
+	replyCmd.Flags().BoolVar(&replyStdin, "stdin", false, "Read message body from stdin")
+	replyCmd.Flags().StringVar(&replyType, "type", "message", "Message type (message, task-proposal, task-result, capability-query, status-update)")
+	replyCmd.Flags().StringSliceVar(&replyMeta, "meta", nil, "Metadata key=value pairs (can be repeated)")
+	replyCmd.Flags().StringSliceVar(&replyCopyMeta, "copy-meta", nil, "Meta keys to copy from the original message (can be repeated)")
+	replyCmd.Flags().StringVar(&replyID, "id", "", "Message ID to use instead of a random one, so retrying a reply can't deliver twice")
+	rootCmd.AddCommand(replyCmd)
+}
+
+var replyCmd = &cobra.Command{
+	Use:   "reply <msg-id> [message]",
+	Short: "Reply to a received message",
+	Long: `Reply to a received message.
+
+The message is looked up in the inbox by full ID or unique ID prefix. The
+reply goes to its sender, with reply_to set to its ID and in the same thread.
+--copy-meta carries meta values over from the original, such as a task ID;
+--meta sets others, and wins over a copied key of the same name.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if replyID != "" && !message.ValidID(replyID) {
+			return fmt.Errorf("invalid --id %q: use 1-128 letters, digits, '.', '_', ':' or '-'", replyID)
+		}
+		extra, err := parseMeta(replyMeta)
+		if err != nil {
+			return err
+		}
+		body, err := readBody(replyStdin, args[1:])
+		if err != nil {
+			return err
+		}
+
+		hollerDir, err := identity.HollerDir()
+		if err != nil {
+			return err
+		}
+		st, err := message.OpenStore(hollerDir)
+		if err != nil {
+			return err
+		}
+		orig, err := findInboxMessage(st, args[0])
+		if err != nil {
+			return err
+		}
+		if !identity.ValidOnionAddr(orig.From) {
+			return fmt.Errorf("message %s has an invalid sender %q", orig.ID, orig.From)
+		}
+
+		meta := make(map[string]string)
+		for _, k := range replyCopyMeta {
+			if v, ok := orig.Meta[k]; ok {
+				meta[k] = v
+			}
+		}
+		for k, v := range extra {
+			meta[k] = v
+		}
+
+		tr, err := loadTransport()
+		if err != nil {
+			return err
+		}
+		if err := tr.CheckDial(); err != nil {
+			return err
+		}
+		return sendMessage(tr, hollerDir, outgoingMessage{
+			to:      orig.From,
+			id:      replyID,
+			msgType: replyType,
+			body:    body,
+			replyTo: orig.ID,
+			thread:  message.ThreadKey(orig),
+			meta:    meta,
+		})
+	},
+}
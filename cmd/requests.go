@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/1F47E/holler/identity"
+	"github.com/1F47E/holler/message"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	requestsCmd.AddCommand(requestsListCmd)
+	requestsCmd.AddCommand(requestsAcceptCmd)
+	requestsCmd.AddCommand(requestsDenyCmd)
+	rootCmd.AddCommand(requestsCmd)
+}
+
+var requestsCmd = &cobra.Command{
+	Use:   "requests",
+	Short: "Review messages from unknown senders (quarantine mode)",
+	RunE:  listRequests,
+}
+
+var requestsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List quarantined messages grouped by sender",
+	RunE:  listRequests,
+}
+
+var requestsAcceptCmd = &cobra.Command{
+	Use:   "accept <onion-addr> [alias]",
+	Short: "Add sender to contacts and deliver their quarantined messages",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hollerDir, err := identity.HollerDir()
+		if err != nil {
+			return err
+		}
+		onionAddr, err := resolveOnion(identity.Contacts{}, args[0])
+		if err != nil {
+			return err
+		}
+		alias := onionAddr[:8]
+		if len(args) == 2 {
+			alias = args[1]
+		}
+
+		contacts, err := identity.LoadContacts()
+		if err != nil {
+			return err
+		}
+		if existing, ok := contacts[alias]; ok && existing != onionAddr {
+			return fmt.Errorf("alias %q already used for %s.onion", alias, existing[:16]+"...")
+		}
+
+		var accepted []*message.Envelope
+		err = message.UpdateRequests(hollerDir, func(envs []*message.Envelope) ([]*message.Envelope, error) {
+			matched, rest, err := splitRequests(envs, onionAddr)
+			if err != nil {
+				return nil, err
+			}
+			// Add the contact first so the sender's next messages skip quarantine.
+			contacts[alias] = onionAddr
+			if err := identity.SaveContacts(contacts); err != nil {
+				return nil, err
+			}
+			accepted = matched
+			return rest, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// No receipts: this process exits before they could be delivered.
+		handler := inboxHandler(hollerDir, nil)
+		delivered := 0
+		for _, env := range accepted {
+			if err := handler(env); err != nil {
+				// Keep it quarantined so a later accept can deliver it.
+				if data, merr := env.Marshal(); merr == nil {
+					message.AppendToRequests(hollerDir, data)
+				}
+				continue
+			}
+			delivered++
+		}
+		fmt.Printf("Accepted %s.onion as %q — delivered %d message(s)\n", onionAddr[:16], alias, delivered)
+		if delivered < len(accepted) {
+			return fmt.Errorf("%d message(s) could not be stored and remain in requests", len(accepted)-delivered)
+		}
+		return nil
+	},
+}
+
+var requestsDenyCmd = &cobra.Command{
+	Use:   "deny <onion-addr>",
+	Short: "Discard a sender's quarantined messages and block them",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hollerDir, err := identity.HollerDir()
+		if err != nil {
+			return err
+		}
+		onionAddr, err := resolveOnion(identity.Contacts{}, args[0])
+		if err != nil {
+			return err
+		}
+		policy, err := identity.LoadPolicy()
+		if err != nil {
+			return err
+		}
+
+		var denied []*message.Envelope
+		err = message.UpdateRequests(hollerDir, func(envs []*message.Envelope) ([]*message.Envelope, error) {
+			matched, rest, err := splitRequests(envs, onionAddr)
+			if err != nil {
+				return nil, err
+			}
+			policy.Block(onionAddr)
+			if err := identity.SavePolicy(policy); err != nil {
+				return nil, err
+			}
+			denied = matched
+			return rest, nil
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Denied %s.onion — discarded %d message(s), sender blocked\n", onionAddr[:16], len(denied))
+		return nil
+	},
+}
+
+func listRequests(cmd *cobra.Command, args []string) error {
+	hollerDir, err := identity.HollerDir()
+	if err != nil {
+		return err
+	}
+	envelopes, err := message.LoadRequests(hollerDir)
+	if err != nil {
+		return err
+	}
+	if len(envelopes) == 0 {
+		fmt.Println("No pending contact requests.")
+		return nil
+	}
+
+	// Group by sender, preserving first-seen order
+	var senders []string
+	bySender := make(map[string][]*message.Envelope)
+	for _, env := range envelopes {
+		if _, ok := bySender[env.From]; !ok {
+			senders = append(senders, env.From)
+		}
+		bySender[env.From] = append(bySender[env.From], env)
+	}
+
+	for i, from := range senders {
+		if i > 0 {
+			fmt.Println()
+		}
+		msgs := bySender[from]
+		fmt.Printf("%s.onion (%d message(s))\n", from, len(msgs))
+		for _, env := range msgs {
+			ts := time.Unix(env.Ts, 0).Format("2006-01-02 15:04:05")
+			fmt.Printf("  [%s] %s: %s\n", ts, env.Type, env.Body)
+		}
+	}
+	return nil
+}
+
+// splitRequests separates the quarantined envelopes from onionAddr from the rest.
+func splitRequests(envelopes []*message.Envelope, onionAddr string) (matched, rest []*message.Envelope, err error) {
+	for _, env := range envelopes {
+		if env.From == onionAddr {
+			matched = append(matched, env)
+		} else {
+			rest = append(rest, env)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, nil, fmt.Errorf("no pending requests from %s.onion", onionAddr[:16])
+	}
+	return matched, rest, nil
+}
@@ -12,9 +12,18 @@ var rootCmd = &cobra.Command{
 	Long:  "holler — peer-to-peer encrypted messaging over Tor. No servers, no registration. Identity is an onion address.",
 }
 
+// transportName is set by the --transport flag.
+var transportName string
+
 func init() {
 	rootCmd.PersistentFlags().StringVar(&identity.DirOverride, "dir", "", "data directory (default ~/.holler)")
 	rootCmd.PersistentFlags().BoolVarP(&node.Verbose, "verbose", "v", false, "verbose debug logging")
+	rootCmd.PersistentFlags().StringVar(&transportName, "transport", node.TransportTor, "transport: tor or loopback (local testing without Tor)")
+}
+
+// loadTransport returns the transport selected by --transport.
+func loadTransport() (node.Transport, error) {
+	return node.NewTransport(transportName)
 }
 
 func Execute() error {
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"os"
 	"os/signal"
@@ -13,15 +12,19 @@ import (
 	"github.com/1F47E/holler/identity"
 	"github.com/1F47E/holler/message"
 	"github.com/1F47E/holler/node"
+	"github.com/cretz/bine/control"
 	"github.com/spf13/cobra"
 )
 
 const (
-	healthCheckInterval = 30 * time.Second
-	reconnectMin        = 5 * time.Second
-	reconnectMax        = 60 * time.Second
+	reconnectMin = 5 * time.Second
+	reconnectMax = 60 * time.Second
 )
 
+// healthCheckInterval is how often the daemon pings its transport.
+// A variable so integration tests against tortest can shorten it.
+var healthCheckInterval = 30 * time.Second
+
 func init() {
 	rootCmd.AddCommand(runDaemonCmd)
 }
@@ -36,7 +39,11 @@ var runDaemonCmd = &cobra.Command{
 			return err
 		}
 
-		if err := node.CheckTorAvailable(); err != nil {
+		tr, err := loadTransport()
+		if err != nil {
+			return err
+		}
+		if err := tr.CheckListen(); err != nil {
 			return err
 		}
 
@@ -44,86 +51,113 @@ var runDaemonCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		onionAddr := identity.OnionAddrFromKey(onionKey)
-		kp := identity.OnionKeyPairFromBine(onionKey)
-
 		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 		defer cancel()
 
-		msgHandler := func(env *message.Envelope) {
-			data, err := json.Marshal(env)
-			if err != nil {
-				return
-			}
-			message.AppendToInbox(hollerDir, data)
-			daemon.RunReceiveHook(hollerDir, env)
+		rs, err := newReceiptSender(tr, hollerDir)
+		if err != nil {
+			return err
+		}
+		recv, err := node.NewReceiver(hollerDir, identity.OnionAddrFromKey(onionKey), identity.OnionKeyPairFromBine(onionKey), inboxHandler(hollerDir, rs))
+		if err != nil {
+			return err
+		}
+
+		runDaemonSessions(ctx, tr, hollerDir, onionKey, recv)
+
+		logDaemon("daemon shutting down")
+		node.WriteStats(hollerDir)
+		daemon.RemovePid(hollerDir)
+		return nil
+	},
+}
+
+// inboxHandler is the daemon's message handler: it stores the envelope in
+// the inbox and runs the on-receive hook, sending a processed receipt when
+// the hook succeeds. Receipts are recorded, not hooked. Accepted contact
+// requests are replayed through it too. rs may be nil to send no receipts.
+func inboxHandler(hollerDir string, rs *receiptSender) node.MessageHandler {
+	return func(env *message.Envelope) error {
+		isReceipt, err := storeEnvelope(hollerDir, env)
+		if err != nil || isReceipt {
+			return err
 		}
+		if daemon.RunReceiveHook(hollerDir, env) && rs != nil {
+			go func() {
+				if _, err := rs.send(context.Background(), message.ReceiptProcessed, env); err != nil {
+					logDaemon("receipt: %v", err)
+				}
+			}()
+		}
+		return nil
+	}
+}
 
-		profile := node.LoadProfile(hollerDir)
-		backoff := reconnectMin
+// runDaemonSessions keeps the service published until ctx is cancelled.
+// Each session lasts until the transport health check fails, after which the
+// service is torn down and re-created with exponential backoff.
+func runDaemonSessions(ctx context.Context, tr node.Transport, hollerDir string, onionKey *control.ED25519Key, recv *node.Receiver) {
+	onionAddr := identity.OnionAddrFromKey(onionKey)
+	profile := node.LoadProfile(hollerDir)
+	backoff := reconnectMin
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
 
-		for {
+		tn, err := tr.Listen(onionKey, onionAddr)
+		if err != nil {
+			logDaemon("%s connect failed: %v (retry in %s)", tr.Name(), err, backoff)
 			select {
 			case <-ctx.Done():
-				goto shutdown
-			default:
+				return
+			case <-time.After(backoff):
 			}
-
-			tn, err := node.ListenTor(onionKey, onionAddr)
-			if err != nil {
-				logDaemon("tor connect failed: %v (retry in %s)", err, backoff)
-				select {
-				case <-ctx.Done():
-					goto shutdown
-				case <-time.After(backoff):
-				}
-				backoff = backoff * 2
-				if backoff > reconnectMax {
-					backoff = reconnectMax
-				}
-				continue
+			backoff = backoff * 2
+			if backoff > reconnectMax {
+				backoff = reconnectMax
 			}
+			continue
+		}
 
-			backoff = reconnectMin
-			logDaemon("daemon started: %s.onion:9000", onionAddr)
-
-			// Run one session until Tor health check fails or shutdown.
-			func() {
-				sessCtx, sessCancel := context.WithCancel(ctx)
-				defer sessCancel()
-				defer tn.Close() //nolint:errcheck
-
-				go node.HandleTorConnections(sessCtx, tn, kp, msgHandler)
-				go node.StartHomepage(sessCtx, tn.HTTPListener(), node.HomepageData{
-					Name:      profile.Name,
-					Bio:       profile.Bio,
-					OnionAddr: onionAddr,
-					Version:   Version,
-				})
-				go retryOutboxLoop(sessCtx, hollerDir)
-
-				// Health check loop — blocks until failure or shutdown
-				ticker := time.NewTicker(healthCheckInterval)
-				defer ticker.Stop()
-				for {
-					select {
-					case <-sessCtx.Done():
+		backoff = reconnectMin
+		logDaemon("daemon started: %s.onion:9000", onionAddr)
+
+		// Run one session until Tor health check fails or shutdown.
+		func() {
+			sessCtx, sessCancel := context.WithCancel(ctx)
+			defer sessCancel()
+			defer tn.Close() //nolint:errcheck
+
+			go recv.Serve(sessCtx, tn)
+			go node.StartHomepage(sessCtx, tn.HTTPListener(), node.HomepageData{
+				Name:      profile.Name,
+				Bio:       profile.Bio,
+				OnionAddr: onionAddr,
+				Version:   Version,
+			})
+			go retryOutboxLoop(sessCtx, tr, hollerDir)
+
+			// Health check loop — blocks until failure or shutdown
+			ticker := time.NewTicker(healthCheckInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-sessCtx.Done():
+					return
+				case <-ticker.C:
+					node.WriteStats(hollerDir)
+					if err := tn.Ping(); err != nil {
+						logDaemon("%s health check failed: %v — reconnecting", tr.Name(), err)
 						return
-					case <-ticker.C:
-						if err := tn.Ping(); err != nil {
-							logDaemon("tor health check failed: %v — reconnecting", err)
-							return
-						}
 					}
 				}
-			}()
-		}
-
-	shutdown:
-		logDaemon("daemon shutting down")
-		daemon.RemovePid(hollerDir)
-		return nil
-	},
+			}
+		}()
+	}
 }
 
 func logDaemon(format string, args ...interface{}) {
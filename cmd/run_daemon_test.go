@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/1F47E/holler/identity"
+	"github.com/1F47E/holler/message"
+	"github.com/1F47E/holler/node"
+	"github.com/1F47E/holler/node/tortest"
+)
+
+// TestDaemonOverFakeTor runs a daemon against tortest: a send is delivered,
+// the daemon re-publishes its onion after a Tor restart, and a send to an
+// unreachable onion is queued in the outbox.
+func TestDaemonOverFakeTor(t *testing.T) {
+	ts, err := tortest.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Close()
+	tr := ts.Transport()
+
+	dirA, dirB := t.TempDir(), t.TempDir()
+	if _, err := node.LoadOrCreateOnionKey(dirA); err != nil {
+		t.Fatal(err)
+	}
+	keyB, err := node.LoadOrCreateOnionKey(dirB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrB := identity.OnionAddrFromKey(keyB)
+
+	// The receiver reads its policy from the global holler dir.
+	defer func(dir string) { identity.DirOverride = dir }(identity.DirOverride)
+	identity.DirOverride = dirB
+	defer func(d time.Duration) { healthCheckInterval = d }(healthCheckInterval)
+	healthCheckInterval = 50 * time.Millisecond
+
+	recv, err := node.NewReceiver(dirB, addrB, identity.OnionKeyPairFromBine(keyB), inboxHandler(dirB, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runDaemonSessions(ctx, tr, dirB, keyB, recv)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	published := func() bool { return slices.Contains(ts.Onions(), addrB) }
+	send := func(body string) {
+		t.Helper()
+		err := sendMessage(tr, dirA, outgoingMessage{to: addrB, msgType: "message", body: body})
+		if err != nil {
+			t.Fatalf("send %q: %v", body, err)
+		}
+	}
+
+	waitFor(t, "onion published", published)
+	send("before restart")
+	waitFor(t, "first message stored", func() bool { return len(inbox(t, dirB)) == 1 })
+
+	ts.Restart()
+	waitFor(t, "onion published again", published)
+	send("after restart")
+	waitFor(t, "second message stored", func() bool { return len(inbox(t, dirB)) == 2 })
+	if n := len(outbox(t, dirA)); n != 0 {
+		t.Fatalf("outbox has %d entries, want 0", n)
+	}
+
+	ts.SetUnreachable(addrB, true)
+	send("while unreachable")
+	queued := outbox(t, dirA)
+	if len(queued) != 1 || queued[0].Envelope.Body != "while unreachable" {
+		t.Fatalf("outbox = %+v, want the unreachable send", queued)
+	}
+	if n := len(inbox(t, dirB)); n != 2 {
+		t.Fatalf("inbox has %d messages, want 2", n)
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func inbox(t *testing.T, dir string) []*message.Envelope {
+	t.Helper()
+	st, err := message.OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envs, err := st.Messages(message.MailboxInbox, message.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return envs
+}
+
+func outbox(t *testing.T, dir string) []message.OutboxEntry {
+	t.Helper()
+	st, err := message.OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := st.Outbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
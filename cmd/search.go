@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/1F47E/holler/identity"
+	"github.com/1F47E/holler/message"
+	"github.com/spf13/cobra"
+)
+
+// snippetWidth is how much of a matching body search shows, in characters.
+const snippetWidth = 80
+
+var (
+	searchIn      string
+	searchPeer    string
+	searchLimit   int
+	searchJSON    bool
+	searchFilters queryFlags
+)
+
+func init() {
+	searchCmd.Flags().StringVar(&searchIn, "in", "all", "Where to search: inbox, sent or all")
+	searchCmd.Flags().StringVar(&searchPeer, "peer", "", "Only messages from or to this peer (alias or onion address)")
+	searchCmd.Flags().IntVarP(&searchLimit, "limit", "n", 20, "Show at most N results (0 = all)")
+	searchCmd.Flags().BoolVar(&searchJSON, "json", false, "JSONL output, with each result's mailbox and score")
+	searchFilters.register(searchCmd)
+	rootCmd.AddCommand(searchCmd)
+}
+
+var searchCmd = &cobra.Command{
+	Use:   "search <query>",
+	Short: "Full-text search over received and sent messages",
+	Long: `Full-text search over the bodies of received and sent messages.
+
+Results contain at least one word of the query, matched case-insensitively,
+and are ranked by relevance (BM25): rare words count for more than common
+ones, and a body containing the whole query as a phrase ranks above one that
+merely has its words. Archived messages are searched too.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var boxes []message.Mailbox
+		switch searchIn {
+		case "all":
+			boxes = []message.Mailbox{message.MailboxInbox, message.MailboxSent}
+		case "inbox":
+			boxes = []message.Mailbox{message.MailboxInbox}
+		case "sent":
+			boxes = []message.Mailbox{message.MailboxSent}
+		default:
+			return fmt.Errorf("invalid --in %q: must be inbox, sent or all", searchIn)
+		}
+		text := strings.Join(args, " ")
+		if len(message.Terms(text)) == 0 {
+			return fmt.Errorf("query %q has no words to search for", text)
+		}
+
+		q, err := searchFilters.query()
+		if err != nil {
+			return err
+		}
+		q.Last = searchLimit
+		contacts, _ := identity.LoadContacts()
+		if searchPeer != "" {
+			q.Peer = contacts.Resolve(searchPeer)
+		}
+
+		hollerDir, err := identity.HollerDir()
+		if err != nil {
+			return err
+		}
+		st, err := message.OpenStore(hollerDir)
+		if err != nil {
+			return err
+		}
+		hits, err := message.Search(st, boxes, text, q)
+		if err != nil {
+			return err
+		}
+		if len(hits) == 0 {
+			fmt.Println("No matching messages.")
+			return nil
+		}
+
+		var states map[string]message.MessageState
+		if searchJSON {
+			if states, err = st.States(); err != nil {
+				return err
+			}
+		}
+		terms := message.Terms(text)
+		for _, hit := range hits {
+			env := hit.Envelope
+			if searchJSON {
+				data, err := json.Marshal(env)
+				if err == nil {
+					data, err = appendJSONField(data, "mailbox", hit.Mailbox)
+				}
+				if err == nil {
+					data, err = appendJSONField(data, "score", math.Round(hit.Score*1000)/1000)
+				}
+				if err == nil && hit.Mailbox == message.MailboxInbox {
+					data, err = appendJSONField(data, "state", message.StateOf(states, env))
+				}
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(data))
+				continue
+			}
+			ts := time.Unix(env.Ts, 0).Format("2006-01-02 15:04:05")
+			peer := shortPeer(contacts, env.From)
+			if hit.Mailbox == message.MailboxSent {
+				peer = "to " + shortPeer(contacts, env.To)
+			}
+			id := env.ID
+			if len(id) > 8 {
+				id = id[:8]
+			}
+			fmt.Printf("%-5s %s [%s] %s: %s\n", hit.Mailbox, id, ts, peer, snippet(env.Body, terms, snippetWidth))
+		}
+		return nil
+	},
+}
+
+// snippet returns up to width characters of body on one line, centred on
+// the first query term it contains.
+func snippet(body string, terms []string, width int) string {
+	body = strings.Join(strings.Fields(body), " ")
+	runes := []rune(body)
+	if len(runes) <= width {
+		return body
+	}
+	lower := strings.ToLower(body)
+	at := -1
+	for _, t := range terms {
+		if i := strings.Index(lower, t); i >= 0 && (at < 0 || i < at) {
+			at = i
+		}
+	}
+	start := 0
+	if at > 0 {
+		// ToLower can change byte lengths, so count runes in the original.
+		start = utf8.RuneCountInString(body[:min(at, len(body))]) - width/3
+	}
+	start = max(0, min(start, len(runes)-width))
+	out := string(runes[start : start+width])
+	if start > 0 {
+		out = "..." + out
+	}
+	if start+width < len(runes) {
+		out += "..."
+	}
+	return out
+}
@@ -3,7 +3,7 @@ package cmd
 import (
 	"bufio"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
@@ -23,6 +23,7 @@ var (
 	sendReplyTo string
 	sendThread  string
 	sendMeta    []string
+	sendID      string
 )
 
 func init() {
@@ -31,6 +32,7 @@ func init() {
 	sendCmd.Flags().StringVar(&sendReplyTo, "reply-to", "", "Message ID this is replying to (for threading)")
 	sendCmd.Flags().StringVar(&sendThread, "thread", "", "Thread ID to continue a conversation")
 	sendCmd.Flags().StringSliceVar(&sendMeta, "meta", nil, "Metadata key=value pairs (can be repeated)")
+	sendCmd.Flags().StringVar(&sendID, "id", "", "Message ID to use instead of a random one, so retrying a send can't deliver twice")
 	rootCmd.AddCommand(sendCmd)
 }
 
@@ -40,42 +42,30 @@ var sendCmd = &cobra.Command{
 	Args:  cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		target := args[0]
-		var body string
-
-		if sendStdin {
-			scanner := bufio.NewScanner(os.Stdin)
-			var lines []string
-			for scanner.Scan() {
-				lines = append(lines, scanner.Text())
-			}
-			if err := scanner.Err(); err != nil {
-				return fmt.Errorf("read stdin: %w", err)
-			}
-			body = strings.Join(lines, "\n")
-		} else {
-			if len(args) < 2 {
-				return fmt.Errorf("provide a message or use --stdin")
-			}
-			body = strings.Join(args[1:], " ")
+		if sendID != "" && !message.ValidID(sendID) {
+			return fmt.Errorf("invalid --id %q: use 1-128 letters, digits, '.', '_', ':' or '-'", sendID)
 		}
-
-		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
-		defer cancel()
-
-		if err := node.CheckTorSOCKS(); err != nil {
+		meta, err := parseMeta(sendMeta)
+		if err != nil {
+			return err
+		}
+		body, err := readBody(sendStdin, args[1:])
+		if err != nil {
 			return err
 		}
 
-		hollerDir, err := identity.HollerDir()
+		tr, err := loadTransport()
 		if err != nil {
 			return err
 		}
-		onionKey, err := node.LoadOrCreateOnionKey(hollerDir)
+		if err := tr.CheckDial(); err != nil {
+			return err
+		}
+
+		hollerDir, err := identity.HollerDir()
 		if err != nil {
 			return err
 		}
-		myOnion := identity.OnionAddrFromKey(onionKey)
-		kp := identity.OnionKeyPairFromBine(onionKey)
 
 		// Resolve target via contacts
 		contacts, err := identity.LoadContacts()
@@ -88,65 +78,171 @@ var sendCmd = &cobra.Command{
 			return fmt.Errorf("cannot resolve %q to a contact — add it with: holler contacts add %s <onion-address>", target, target)
 		}
 
-		// Build envelope
-		env := message.NewEnvelope(myOnion, toOnion, sendType, body)
-		env.ReplyTo = sendReplyTo
-		switch {
-		case sendThread != "":
-			env.ThreadID = sendThread
-		case sendReplyTo != "":
-			env.ThreadID = sendReplyTo
-		default:
-			env.ThreadID = env.ID
-		}
-		if len(sendMeta) > 0 {
-			env.Meta = make(map[string]string)
-			for _, kv := range sendMeta {
-				if k, v, ok := strings.Cut(kv, "="); ok {
-					env.Meta[k] = v
-				}
-			}
-		}
-		if err := env.Sign(kp); err != nil {
-			return fmt.Errorf("sign message: %w", err)
+		return sendMessage(tr, hollerDir, outgoingMessage{
+			to:      toOnion,
+			id:      sendID,
+			msgType: sendType,
+			body:    body,
+			replyTo: sendReplyTo,
+			thread:  sendThread,
+			meta:    meta,
+		})
+	},
+}
+
+// outgoingMessage is what send and reply fill in an envelope with.
+type outgoingMessage struct {
+	to      string // recipient onion address
+	id      string // caller-supplied message ID, or empty for a random one
+	msgType string
+	body    string
+	replyTo string
+	thread  string
+	meta    map[string]string
+}
+
+// sendMessage signs m and delivers it, queueing it in the outbox if the
+// recipient can't be reached.
+func sendMessage(tr node.Transport, hollerDir string, m outgoingMessage) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	onionKey, err := node.LoadOrCreateOnionKey(hollerDir)
+	if err != nil {
+		return err
+	}
+	myOnion := identity.OnionAddrFromKey(onionKey)
+	kp := identity.OnionKeyPairFromBine(onionKey)
+
+	if m.id != "" {
+		done, err := alreadySent(hollerDir, m.id, m.to)
+		if err != nil || done {
+			return err
 		}
+	}
 
-		// Dial and send
-		fmt.Fprintf(os.Stderr, "Connecting to %s.onion...\n", toOnion[:16])
-		connectCtx, connectCancel := context.WithTimeout(ctx, 120*time.Second)
-		defer connectCancel()
+	// Build envelope
+	env := message.NewEnvelope(myOnion, m.to, m.msgType, m.body)
+	if m.id != "" {
+		env.ID = m.id
+	}
+	env.ReplyTo = m.replyTo
+	switch {
+	case m.thread != "":
+		env.ThreadID = m.thread
+	case m.replyTo != "":
+		env.ThreadID = m.replyTo
+	default:
+		env.ThreadID = env.ID
+	}
+	if len(m.meta) > 0 {
+		env.Meta = m.meta
+	}
+	if err := env.Sign(kp); err != nil {
+		return fmt.Errorf("sign message: %w", err)
+	}
 
-		conn, err := node.DialTor(connectCtx, toOnion, 9000)
-		if err != nil {
-			message.SaveToOutbox(hollerDir, env)
-			printOutboxHint(hollerDir)
-			return nil
+	// Dial and send
+	fmt.Fprintf(os.Stderr, "Connecting to %s.onion...\n", m.to[:16])
+	connectCtx, connectCancel := context.WithTimeout(ctx, 120*time.Second)
+	defer connectCancel()
+
+	reply, err := deliver(connectCtx, tr, kp, env)
+	var nack *nackError
+	switch {
+	case errors.As(err, &nack) && nack.permanent():
+		trackDelivery(hollerDir, env, message.DeliveryFailed, 1, err, reply)
+		return fmt.Errorf("message rejected by %s.onion: %v", m.to[:16], nack)
+	case err != nil:
+		// Also when no ack came back: the peer acks a resend it already
+		// has without processing it again, so retrying is safe.
+		trackDelivery(hollerDir, env, message.DeliveryAttempt, 1, err, nil)
+		if qerr := enqueue(hollerDir, env, err); qerr != nil {
+			return fmt.Errorf("send failed (%v) and could not be queued: %w", err, qerr)
 		}
-		defer conn.Close()
+		trackDelivery(hollerDir, env, message.DeliveryQueued, 0, nil, nil)
+		fmt.Fprintf(os.Stderr, "Send failed — queued in outbox: %v\n", err)
+		printOutboxHint(hollerDir)
+		return nil
+	}
+	recordReply(hollerDir, reply)
+	recordSent(hollerDir, env)
+	trackDelivery(hollerDir, env, message.DeliveryDelivered, 1, nil, reply)
+	if reply.Type == "nack" {
+		fmt.Fprintf(os.Stderr, "Already delivered to %s.onion\n", m.to[:16])
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "Message sent to %s.onion\n", m.to[:16])
+	return nil
+}
 
-		if err := node.SendTor(conn, env); err != nil {
-			message.SaveToOutbox(hollerDir, env)
-			fmt.Fprintf(os.Stderr, "Send failed — queued in outbox: %v\n", err)
-			printOutboxHint(hollerDir)
-			return nil
+// readBody returns the message body from stdin or from the remaining
+// command-line arguments.
+func readBody(stdin bool, args []string) (string, error) {
+	if !stdin {
+		if len(args) == 0 {
+			return "", fmt.Errorf("provide a message or use --stdin")
 		}
+		return strings.Join(args, " "), nil
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("read stdin: %w", err)
+	}
+	return strings.Join(lines, "\n"), nil
+}
 
-		// Wait for ack and verify signature
-		ack, err := node.RecvTor(conn)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "No ack received (message likely delivered): %v\n", err)
-		} else if ack.Type == "ack" && ack.Body == env.ID {
-			if valid, verr := ack.Verify(); verr != nil || !valid {
-				fmt.Fprintf(os.Stderr, "Ack signature invalid\n")
-			}
+// parseMeta turns --meta key=value pairs into a map. A pair without an =
+// or with an empty key is an error.
+func parseMeta(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	meta := make(map[string]string, len(pairs))
+	for _, kv := range pairs {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid --meta %q: want key=value", kv)
 		}
+		meta[k] = v
+	}
+	return meta, nil
+}
 
-		if sentData, err := json.Marshal(env); err == nil {
-			message.AppendToSent(hollerDir, sentData)
+// alreadySent reports whether a message with this caller-supplied ID was
+// already delivered to, or queued for, toOnion, so an agent retrying a send
+// doesn't create a second copy.
+func alreadySent(hollerDir, id, toOnion string) (bool, error) {
+	st, err := message.OpenStore(hollerDir)
+	if err != nil {
+		return false, err
+	}
+	sent, err := st.Messages(message.MailboxSent, message.Query{ID: id, Peer: toOnion})
+	if err != nil {
+		return false, err
+	}
+	for _, env := range sent {
+		if env.ID == id {
+			fmt.Fprintf(os.Stderr, "Already delivered %s to %s.onion\n", id, toOnion[:16])
+			return true, nil
 		}
-		fmt.Fprintf(os.Stderr, "Message sent to %s.onion\n", toOnion[:16])
-		return nil
-	},
+	}
+	entries, err := st.Outbox()
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		if entry.Envelope.ID == id && entry.Envelope.To == toOnion {
+			fmt.Fprintf(os.Stderr, "Already queued %s for %s.onion\n", id, toOnion[:16])
+			printOutboxHint(hollerDir)
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 func printOutboxHint(hollerDir string) {
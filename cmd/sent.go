@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/1F47E/holler/identity"
+	"github.com/1F47E/holler/message"
+	"github.com/spf13/cobra"
+)
+
+var (
+	sentLast    int
+	sentTo      string
+	sentJSON    bool
+	sentFilters queryFlags
+)
+
+func init() {
+	sentCmd.Flags().IntVarP(&sentLast, "last", "n", 0, "Show last N messages (0 = all)")
+	sentCmd.Flags().StringVar(&sentTo, "to", "", "Filter by recipient (alias or onion address)")
+	sentCmd.Flags().BoolVar(&sentJSON, "json", false, "Raw JSONL output, with the receipts each message got")
+	sentFilters.register(sentCmd)
+	rootCmd.AddCommand(sentCmd)
+}
+
+var sentCmd = &cobra.Command{
+	Use:   "sent",
+	Short: "View delivered messages",
+	Long: `View the messages you delivered, oldest first, with the receipts each got
+back. Messages still in the outbox are listed by 'holler outbox'.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hollerDir, err := identity.HollerDir()
+		if err != nil {
+			return err
+		}
+
+		st, err := message.OpenStore(hollerDir)
+		if err != nil {
+			return err
+		}
+
+		q, err := sentFilters.query()
+		if err != nil {
+			return err
+		}
+		q.Last = sentLast
+
+		// Load contacts for --to and for alias resolution in display
+		contacts, _ := identity.LoadContacts()
+		if sentTo != "" {
+			q.Peer = contacts.Resolve(sentTo)
+		}
+		envelopes, err := st.Messages(message.MailboxSent, q)
+		if err != nil {
+			return err
+		}
+
+		if len(envelopes) == 0 {
+			if q.Peer != "" || sentFilters.set() {
+				fmt.Println("No matching messages.")
+			} else {
+				fmt.Println("No sent messages.")
+			}
+			return nil
+		}
+
+		receipts, err := message.LoadReceipts(hollerDir)
+		if err != nil {
+			return err
+		}
+		// Receipts are keyed by message ID and sender, and a message only
+		// shows those from its recipient: anyone can sign a receipt naming
+		// one of our IDs, and caller-supplied IDs repeat across peers.
+		type receiptKey struct{ id, from string }
+		got := make(map[receiptKey][]string)
+		for _, r := range receipts {
+			key := receiptKey{r.Body, r.From}
+			got[key] = append(got[key], r.Type)
+		}
+
+		for _, env := range envelopes {
+			if sentJSON {
+				data, err := json.Marshal(env)
+				if err == nil {
+					data, err = appendJSONField(data, "receipts", got[receiptKey{env.ID, env.To}])
+				}
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(data))
+				continue
+			}
+			ts := time.Unix(env.Ts, 0).Format("2006-01-02 15:04:05")
+			id := env.ID
+			if len(id) > 8 {
+				id = id[:8]
+			}
+			line := fmt.Sprintf("%s [%s] to %s: %s", id, ts, shortPeer(contacts, env.To), env.Body)
+			if r := got[receiptKey{env.ID, env.To}]; len(r) > 0 {
+				line += " (" + strings.Join(r, ",") + ")"
+			}
+			fmt.Println(line)
+		}
+		return nil
+	},
+}
@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/1F47E/holler/identity"
+	"github.com/1F47E/holler/message"
+	"github.com/spf13/cobra"
+)
+
+var statusJSON bool
+
+func init() {
+	statusCmd.Flags().BoolVar(&statusJSON, "json", false, "JSON output")
+	rootCmd.AddCommand(statusCmd)
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status [msg-id]",
+	Short: "Show what happened to sent messages",
+	Long: `Show the delivery lifecycle of outgoing messages: queued, failed attempts,
+delivered (with the recipient's signed ack), failed or expired, plus any
+processed/read receipts. Without an ID, lists every tracked message.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hollerDir, err := identity.HollerDir()
+		if err != nil {
+			return err
+		}
+		events, err := message.LoadDeliveries(hollerDir)
+		if err != nil {
+			return err
+		}
+		receipts, err := message.LoadReceipts(hollerDir)
+		if err != nil {
+			return err
+		}
+		statuses := message.DeliveryStatuses(events, receipts)
+		contacts, _ := identity.LoadContacts()
+
+		if len(args) == 0 {
+			if len(statuses) == 0 {
+				fmt.Println("No tracked messages.")
+				return nil
+			}
+			for _, st := range statuses {
+				if statusJSON {
+					data, _ := json.Marshal(st)
+					fmt.Println(string(data))
+					continue
+				}
+				fmt.Println(formatStatus(st, contacts))
+			}
+			return nil
+		}
+
+		matches, err := findStatuses(statuses, args[0])
+		if err != nil {
+			return err
+		}
+		for _, st := range matches {
+			printStatusHistory(st, events, receipts, contacts)
+		}
+		return nil
+	},
+}
+
+// formatStatus renders one message's current state on a line.
+func formatStatus(st *message.DeliveryStatus, contacts identity.Contacts) string {
+	id := st.ID
+	if len(id) > 8 {
+		id = id[:8]
+	}
+	line := fmt.Sprintf("[%s] %s  %-19s %s", formatTs(st.Updated), id, shortPeer(contacts, st.To), st.State)
+	if st.Attempts > 0 {
+		line += fmt.Sprintf(" (%d attempt(s))", st.Attempts)
+	}
+	if len(st.Receipts) > 0 {
+		line += " receipts: " + strings.Join(st.Receipts, ",")
+	}
+	if st.LastError != "" && (!st.Terminal() || st.State == message.DeliveryFailed) {
+		line += " — " + st.LastError
+	}
+	return line
+}
+
+// printStatusHistory shows one message's lifecycle events and the receipts
+// its recipient sent.
+func printStatusHistory(st *message.DeliveryStatus, events []message.DeliveryEvent, receipts []*message.Envelope, contacts identity.Contacts) {
+	var history []message.DeliveryEvent
+	for _, ev := range events {
+		if ev.ID == st.ID && ev.To == st.To {
+			history = append(history, ev)
+		}
+	}
+	var stReceipts []*message.Envelope
+	for _, r := range receipts {
+		if r.Body == st.ID && r.From == st.To {
+			stReceipts = append(stReceipts, r)
+		}
+	}
+
+	if statusJSON {
+		data, _ := json.Marshal(map[string]interface{}{
+			"status":   st,
+			"events":   history,
+			"receipts": stReceipts,
+		})
+		fmt.Println(string(data))
+		return
+	}
+
+	fmt.Printf("Message %s to %s\n", st.ID, displayOnion(contacts, st.To))
+	for _, ev := range history {
+		line := fmt.Sprintf("  [%s] %s", formatTs(ev.Ts), ev.Event)
+		if ev.Attempt > 0 {
+			line += fmt.Sprintf(" (attempt %d)", ev.Attempt)
+		}
+		if ev.AckType != "" {
+			line += fmt.Sprintf(" — %s %s, sig %s", ev.AckType, ev.AckID, ev.AckSig)
+		}
+		if ev.Error != "" {
+			line += ": " + ev.Error
+		}
+		fmt.Println(line)
+	}
+	for _, r := range stReceipts {
+		fmt.Printf("  [%s] %s receipt\n", formatTs(r.Ts), r.Type)
+	}
+}
+
+// shortPeer renders an onion address as its alias, or abbreviated.
+func shortPeer(contacts identity.Contacts, addr string) string {
+	if alias, found := contacts.FindByOnion(addr); found {
+		return alias
+	}
+	if len(addr) > 16 {
+		return addr[:16] + "..."
+	}
+	return addr
+}
+
+// findStatuses looks up a message by full ID or unique ID prefix. A
+// caller-supplied ID sent to several peers has a status for each.
+func findStatuses(statuses []*message.DeliveryStatus, id string) ([]*message.DeliveryStatus, error) {
+	var exact, prefixed []*message.DeliveryStatus
+	for _, st := range statuses {
+		switch {
+		case st.ID == id:
+			exact = append(exact, st)
+		case strings.HasPrefix(st.ID, id):
+			if len(prefixed) > 0 && prefixed[0].ID != st.ID {
+				return nil, fmt.Errorf("message ID prefix %q is ambiguous", id)
+			}
+			prefixed = append(prefixed, st)
+		}
+	}
+	switch {
+	case len(exact) > 0:
+		return exact, nil
+	case len(prefixed) > 0:
+		return prefixed, nil
+	}
+	return nil, fmt.Errorf("no tracked message with ID %q", id)
+}
+
+func formatTs(ts int64) string {
+	return time.Unix(ts, 0).Format("2006-01-02 15:04:05")
+}
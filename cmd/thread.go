@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/1F47E/holler/identity"
+	"github.com/1F47E/holler/message"
+	"github.com/spf13/cobra"
+)
+
+var threadJSON bool
+
+func init() {
+	threadCmd.Flags().BoolVar(&threadJSON, "json", false, "JSONL output in time order, with each message's mailbox and reply depth")
+	rootCmd.AddCommand(threadCmd)
+}
+
+var threadCmd = &cobra.Command{
+	Use:   "thread <thread-id|msg-id>",
+	Short: "Show a conversation from both the inbox and the sent log",
+	Long: `Show a conversation from both the inbox and the sent log as a reply tree.
+
+The argument is a thread ID, or the full ID or unique prefix of any message
+in the thread. Replies are indented under the message they answer; messages
+whose parent isn't stored start at the left margin.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hollerDir, err := identity.HollerDir()
+		if err != nil {
+			return err
+		}
+		st, err := message.OpenStore(hollerDir)
+		if err != nil {
+			return err
+		}
+		id, msgs, err := findThread(st, args[0])
+		if err != nil {
+			return err
+		}
+		tree := replyTree(msgs)
+
+		if threadJSON {
+			for _, line := range chronological(tree) {
+				data, err := json.Marshal(line.msg.Envelope)
+				if err == nil {
+					data, err = appendJSONField(data, "mailbox", line.msg.Mailbox)
+				}
+				if err == nil {
+					data, err = appendJSONField(data, "depth", line.depth)
+				}
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(data))
+			}
+			return nil
+		}
+
+		contacts, _ := identity.LoadContacts()
+		peers := make(map[string]bool)
+		var names []string
+		for _, msg := range msgs {
+			p := msg.Envelope.From
+			if msg.Mailbox == message.MailboxSent {
+				p = msg.Envelope.To
+			}
+			if !peers[p] {
+				peers[p] = true
+				names = append(names, shortPeer(contacts, p))
+			}
+		}
+		fmt.Printf("Thread %s: %d message(s) with %s\n\n", id, len(msgs), strings.Join(names, ", "))
+		for _, line := range tree {
+			env := line.msg.Envelope
+			indent := strings.Repeat("  ", line.depth)
+			if line.depth > 0 {
+				indent = strings.Repeat("  ", line.depth-1) + "↳ "
+			}
+			sender := "you"
+			if line.msg.Mailbox == message.MailboxInbox {
+				sender = shortPeer(contacts, env.From)
+			}
+			id := env.ID
+			if len(id) > 8 {
+				id = id[:8]
+			}
+			ts := time.Unix(env.Ts, 0).Format("2006-01-02 15:04:05")
+			body := strings.Split(strings.TrimRight(env.Body, "\n"), "\n")
+			fmt.Printf("%s%s [%s] %s: %s\n", indent, id, ts, sender, body[0])
+			for _, l := range body[1:] {
+				fmt.Printf("%s  %s\n", strings.Repeat("  ", line.depth), l)
+			}
+		}
+		return nil
+	},
+}
+
+// findThread returns the thread with the given ID, or else the thread of
+// the message with that full ID or unique ID prefix.
+func findThread(st message.Store, id string) (string, []message.ThreadMessage, error) {
+	msgs, err := message.Thread(st, id)
+	if err != nil || len(msgs) > 0 {
+		return id, msgs, err
+	}
+	var envs []*message.Envelope
+	seen := make(map[string]bool)
+	for _, box := range []message.Mailbox{message.MailboxInbox, message.MailboxSent} {
+		found, err := st.Messages(box, message.Query{ID: id})
+		if err != nil {
+			return "", nil, err
+		}
+		for _, env := range found {
+			if !seen[env.Key()] {
+				seen[env.Key()] = true
+				envs = append(envs, env)
+			}
+		}
+	}
+	env, err := findEnvelope(envs, id)
+	if err != nil {
+		return "", nil, fmt.Errorf("no thread or message with ID %q", id)
+	}
+	id = message.ThreadKey(env)
+	msgs, err = message.Thread(st, id)
+	return id, msgs, err
+}
+
+// chronological returns the lines of a reply tree in time order. Timestamps
+// only have second resolution; sorting the tree rather than the raw messages
+// keeps a parent ahead of a reply from the same second.
+func chronological(tree []treeLine) []treeLine {
+	lines := append([]treeLine(nil), tree...)
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].msg.Envelope.Ts < lines[j].msg.Envelope.Ts
+	})
+	return lines
+}
+
+// treeLine is one message of a rendered reply tree.
+type treeLine struct {
+	msg   message.ThreadMessage
+	depth int
+}
+
+// replyTree orders msgs, which are oldest first, depth-first by reply: each
+// message is followed by its replies, oldest first. Messages whose parent
+// isn't in msgs are roots.
+func replyTree(msgs []message.ThreadMessage) []treeLine {
+	byID := make(map[string]bool, len(msgs))
+	for _, msg := range msgs {
+		byID[msg.Envelope.ID] = true
+	}
+	children := make(map[string][]message.ThreadMessage)
+	var roots []message.ThreadMessage
+	for _, msg := range msgs {
+		parent := msg.Envelope.ReplyTo
+		if parent == "" || parent == msg.Envelope.ID || !byID[parent] {
+			roots = append(roots, msg)
+			continue
+		}
+		children[parent] = append(children[parent], msg)
+	}
+
+	var lines []treeLine
+	visited := make(map[string]bool, len(msgs))
+	var walk func(msg message.ThreadMessage, depth int)
+	walk = func(msg message.ThreadMessage, depth int) {
+		if visited[msg.Envelope.Key()] {
+			return
+		}
+		visited[msg.Envelope.Key()] = true
+		lines = append(lines, treeLine{msg: msg, depth: depth})
+		for _, child := range children[msg.Envelope.ID] {
+			walk(child, depth+1)
+		}
+	}
+	for _, root := range roots {
+		walk(root, 0)
+	}
+	// Replies that only reach each other (a reply_to cycle) have no root.
+	for _, msg := range msgs {
+		walk(msg, 0)
+	}
+	return lines
+}
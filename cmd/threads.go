@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/1F47E/holler/identity"
+	"github.com/1F47E/holler/message"
+	"github.com/spf13/cobra"
+)
+
+// subjectWidth is how much of a thread's first message threads shows.
+const subjectWidth = 60
+
+var (
+	threadsLast int
+	threadsPeer string
+	threadsJSON bool
+)
+
+func init() {
+	threadsCmd.Flags().IntVarP(&threadsLast, "last", "n", 0, "Show the N most recently active threads (0 = all)")
+	threadsCmd.Flags().StringVar(&threadsPeer, "peer", "", "Only threads with this peer (alias or onion address)")
+	threadsCmd.Flags().BoolVar(&threadsJSON, "json", false, "JSONL output")
+	rootCmd.AddCommand(threadsCmd)
+}
+
+// threadJSONLine is one line of `holler threads --json`.
+type threadJSONLine struct {
+	ThreadID     string   `json:"thread_id"`
+	Participants []string `json:"participants"`
+	Messages     int      `json:"messages"`
+	Unread       int      `json:"unread"`
+	FirstTs      int64    `json:"first_ts"`
+	LastTs       int64    `json:"last_ts"`
+	Subject      string   `json:"subject"`
+}
+
+var threadsCmd = &cobra.Command{
+	Use:   "threads",
+	Short: "List conversations, most recently active first",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hollerDir, err := identity.HollerDir()
+		if err != nil {
+			return err
+		}
+		st, err := message.OpenStore(hollerDir)
+		if err != nil {
+			return err
+		}
+		threads, err := message.Threads(st)
+		if err != nil {
+			return err
+		}
+
+		contacts, _ := identity.LoadContacts()
+		if threadsPeer != "" {
+			peer := contacts.Resolve(threadsPeer)
+			var with []*message.ThreadSummary
+			for _, t := range threads {
+				for _, p := range t.Participants {
+					if p == peer {
+						with = append(with, t)
+						break
+					}
+				}
+			}
+			threads = with
+		}
+		if threadsLast > 0 && len(threads) > threadsLast {
+			threads = threads[:threadsLast]
+		}
+		if len(threads) == 0 {
+			fmt.Println("No threads.")
+			return nil
+		}
+
+		for _, t := range threads {
+			subject := strings.Join(strings.Fields(t.First.Body), " ")
+			if threadsJSON {
+				data, err := json.Marshal(threadJSONLine{
+					ThreadID:     t.ID,
+					Participants: t.Participants,
+					Messages:     t.Messages,
+					Unread:       t.Unread,
+					FirstTs:      t.First.Ts,
+					LastTs:       t.LastTs,
+					Subject:      subject,
+				})
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(data))
+				continue
+			}
+			names := make([]string, len(t.Participants))
+			for i, p := range t.Participants {
+				names[i] = shortPeer(contacts, p)
+			}
+			if r := []rune(subject); len(r) > subjectWidth {
+				subject = string(r[:subjectWidth]) + "..."
+			}
+			id := t.ID
+			if len(id) > 8 {
+				id = id[:8]
+			}
+			count := fmt.Sprintf("%d msg", t.Messages)
+			if t.Unread > 0 {
+				count += fmt.Sprintf(", %d new", t.Unread)
+			}
+			last := time.Unix(t.LastTs, 0).Format("2006-01-02 15:04")
+			fmt.Printf("%s [%s] %-14s %s: %s\n", id, last, count, strings.Join(names, ", "), subject)
+		}
+		return nil
+	},
+}
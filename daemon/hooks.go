@@ -17,50 +17,77 @@ import (
 const hookTimeout = 10 * time.Second
 
 // RunReceiveHook runs the on-receive hook if it exists and is executable.
-// Skips ack and ping message types. Errors are logged, never fatal.
-func RunReceiveHook(dir string, env *message.Envelope) {
+// Skips control messages (acks, pings, receipts). Errors are logged, never
+// fatal. Returns true if the hook ran and exited 0, meaning it processed the
+// message.
+func RunReceiveHook(dir string, env *message.Envelope) bool {
 	// Skip internal message types
-	if env.Type == "ack" || env.Type == "ping" {
-		return
-	}
-
-	hookPath := filepath.Join(dir, "hooks", "on-receive")
-	info, err := os.Stat(hookPath)
-	if err != nil || info.Mode()&0111 == 0 {
-		return // hook doesn't exist or isn't executable
+	if !message.WantsReceipts(env.Type) {
+		return false
 	}
 
 	raw, err := json.Marshal(env)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "hook: marshal error: %v\n", err)
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
-	defer cancel()
-
-	cmd := exec.CommandContext(ctx, hookPath)
-	cmd.Stdin = bytes.NewReader(raw)
-	cmd.Stdout = os.Stderr // hook output goes to daemon log
-	cmd.Stderr = os.Stderr
-
-	// Set environment variables (sanitize newlines to prevent env var injection)
-	sanitize := func(s string) string {
-		return strings.ReplaceAll(strings.ReplaceAll(s, "\n", " "), "\r", " ")
+		return false
 	}
 	body := env.Body
 	if len(body) > 256 {
 		body = body[:256]
 	}
-	cmd.Env = append(os.Environ(),
+	return runHook(dir, "on-receive", raw,
 		"HOLLER_MSG_ID="+env.ID,
 		"HOLLER_MSG_FROM="+env.From,
 		"HOLLER_MSG_TYPE="+sanitize(env.Type),
 		"HOLLER_MSG_BODY="+sanitize(body),
 		fmt.Sprintf("HOLLER_MSG_TS=%d", env.Ts),
 	)
+}
+
+// RunFailHook runs the on-fail hook, if present, for a message moved to the
+// dead-letter queue. The dead letter's JSON is piped to stdin.
+func RunFailHook(dir string, dl message.DeadLetter) {
+	raw, err := json.Marshal(dl)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hook: marshal error: %v\n", err)
+		return
+	}
+	env := dl.Envelope
+	runHook(dir, "on-fail", raw,
+		"HOLLER_MSG_ID="+env.ID,
+		"HOLLER_MSG_TO="+env.To,
+		"HOLLER_MSG_TYPE="+sanitize(env.Type),
+		"HOLLER_FAIL_REASON="+sanitize(dl.Reason),
+		fmt.Sprintf("HOLLER_FAIL_ATTEMPTS=%d", dl.Attempts),
+	)
+}
+
+// runHook runs hooks/<name> with stdin and extra environment variables.
+// Returns true if the hook exists and exited 0.
+func runHook(dir, name string, stdin []byte, env ...string) bool {
+	hookPath := filepath.Join(dir, "hooks", name)
+	info, err := os.Stat(hookPath)
+	if err != nil || info.Mode()&0111 == 0 {
+		return false // hook doesn't exist or isn't executable
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, hookPath)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = os.Stderr // hook output goes to daemon log
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), env...)
 
 	if err := cmd.Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "hook: on-receive error: %v\n", err)
+		fmt.Fprintf(os.Stderr, "hook: %s error: %v\n", name, err)
+		return false
 	}
+	return true
+}
+
+// sanitize strips newlines to prevent env var injection.
+func sanitize(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\n", " "), "\r", " ")
 }
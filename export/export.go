@@ -0,0 +1,162 @@
+// Package export renders conversations for people and other tools: as
+// Markdown, a standalone HTML page, JSON, or a Maildir tree that mail
+// clients can browse.
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/1F47E/holler/message"
+)
+
+// Export formats.
+const (
+	FormatMarkdown = "md"
+	FormatHTML     = "html"
+	FormatJSON     = "json"
+	FormatMaildir  = "maildir"
+)
+
+// Signature check results.
+const (
+	SigVerified    = "verified"    // signed by the onion address in from
+	SigInvalid     = "invalid"     // the signature doesn't match
+	SigUncheckable = "uncheckable" // e.g. a malformed sender address
+)
+
+// Message is an envelope to export, with where it was found and whether its
+// signature holds.
+type Message struct {
+	Mailbox   message.Mailbox
+	Envelope  *message.Envelope
+	Read      bool   // read, for inbox messages; sent ones always are
+	Signature string // SigVerified, SigInvalid or SigUncheckable
+	SigError  string // why the signature couldn't be checked
+}
+
+// NewMessage checks env's signature and returns it ready to export.
+func NewMessage(box message.Mailbox, env *message.Envelope, read bool) Message {
+	m := Message{Mailbox: box, Envelope: env, Read: read || box == message.MailboxSent}
+	ok, err := env.Verify()
+	switch {
+	case err != nil:
+		m.Signature, m.SigError = SigUncheckable, err.Error()
+	case ok:
+		m.Signature = SigVerified
+	default:
+		m.Signature = SigInvalid
+	}
+	return m
+}
+
+// Conversation is a set of messages to export, oldest first.
+type Conversation struct {
+	Title    string
+	Self     string            // our onion address
+	Names    map[string]string // display names by onion address, e.g. contact aliases
+	Exported time.Time
+	Messages []Message
+}
+
+// Name returns how addr is shown: its display name, "me" for our own
+// address, or else the address abbreviated.
+func (c *Conversation) Name(addr string) string {
+	if name, ok := c.Names[addr]; ok {
+		return name
+	}
+	if addr == c.Self {
+		return "me"
+	}
+	if len(addr) > 16 {
+		return addr[:16] + "..."
+	}
+	return addr
+}
+
+// Participants returns the display names of everyone in the conversation,
+// in order of first appearance.
+func (c *Conversation) Participants() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, m := range c.Messages {
+		for _, addr := range []string{m.Envelope.From, m.Envelope.To} {
+			if !seen[addr] {
+				seen[addr] = true
+				names = append(names, c.Name(addr))
+			}
+		}
+	}
+	return names
+}
+
+// jsonMessage is one message of the JSON export.
+type jsonMessage struct {
+	Mailbox   message.Mailbox   `json:"mailbox"`
+	Signature string            `json:"signature"`
+	SigError  string            `json:"signature_error,omitempty"`
+	Envelope  *message.Envelope `json:"envelope"`
+}
+
+// JSON writes the conversation as one indented JSON document.
+func (c *Conversation) JSON(w io.Writer) error {
+	doc := struct {
+		Title    string        `json:"title"`
+		Exported int64         `json:"exported"`
+		Messages []jsonMessage `json:"messages"`
+	}{Title: c.Title, Exported: c.Exported.Unix(), Messages: []jsonMessage{}}
+	for _, m := range c.Messages {
+		doc.Messages = append(doc.Messages, jsonMessage{
+			Mailbox:   m.Mailbox,
+			Signature: m.Signature,
+			SigError:  m.SigError,
+			Envelope:  m.Envelope,
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("write json: %w", err)
+	}
+	return nil
+}
+
+// EscapeID makes a message ID safe for file names and mail Message-IDs:
+// letters, digits, '-' and '_' are kept and every other byte becomes =XX,
+// so distinct IDs stay distinct.
+func EscapeID(id string) string {
+	var b strings.Builder
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "=%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// summary returns the first line of body, cut to width characters.
+func summary(body string, width int) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(body), "\n")
+	line = strings.TrimSpace(line)
+	if r := []rune(line); len(r) > width {
+		return string(r[:width]) + "..."
+	}
+	return line
+}
@@ -0,0 +1,113 @@
+package export
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+)
+
+// htmlPage is a self-contained page: no scripts, no external resources.
+var htmlPage = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; max-width: 50rem; margin: 2rem auto; padding: 0 1rem; color: #1f2328; background: #fff; }
+header p { color: #59636e; }
+article { border: 1px solid #d1d9e0; border-radius: 6px; margin: 1rem 0; }
+article.sent { border-left: 4px solid #0969da; }
+article.inbox { border-left: 4px solid #8250df; }
+.head { display: flex; justify-content: space-between; gap: 1rem; padding: .5rem .75rem; background: #f6f8fa; border-bottom: 1px solid #d1d9e0; }
+.head time { color: #59636e; white-space: nowrap; }
+.facts { padding: .25rem .75rem; font-size: .85rem; color: #59636e; }
+.facts code { font-size: .8rem; }
+.sig-verified { color: #1a7f37; }
+.sig-invalid { color: #d1242f; font-weight: bold; }
+.sig-uncheckable { color: #9a6700; }
+dl { margin: 0; padding: 0 .75rem; font-size: .85rem; display: grid; grid-template-columns: max-content auto; gap: 0 1rem; }
+dt { font-weight: 600; }
+dd { margin: 0; }
+pre { margin: 0; padding: .75rem; white-space: pre-wrap; word-wrap: break-word; font-size: .9rem; }
+</style>
+</head>
+<body>
+<header>
+<h1>{{.Title}}</h1>
+<p>Exported {{.Exported}} · {{len .Messages}} message(s) · {{range $i, $p := .Participants}}{{if $i}}, {{end}}{{$p}}{{end}}</p>
+</header>
+{{range .Messages}}<article class="{{.Mailbox}}" id="{{.ID}}">
+<div class="head"><strong>{{.From}} → {{.To}}</strong><time datetime="{{.ISOTime}}">{{.Time}}</time></div>
+<div class="facts"><code>{{.ID}}</code> · type <code>{{.Type}}</code>{{if .ReplyTo}} · reply to {{if .ReplyInPage}}<a href="#{{.ReplyTo}}"><code>{{.ReplyTo}}</code></a>{{else}}<code>{{.ReplyTo}}</code>{{end}}{{end}} · signature <span class="sig-{{.Signature}}"{{if .SigError}} title="{{.SigError}}"{{end}}>{{.Signature}}</span></div>
+{{if .Meta}}<dl>{{range .Meta}}<dt>{{.Key}}</dt><dd>{{.Value}}</dd>{{end}}</dl>
+{{end}}<pre>{{.Body}}</pre>
+</article>
+{{end}}</body>
+</html>
+`))
+
+type htmlMeta struct {
+	Key, Value string
+}
+
+type htmlMessage struct {
+	Mailbox     string
+	ID          string
+	From, To    string
+	Time        string
+	ISOTime     string
+	Type        string
+	ReplyTo     string
+	ReplyInPage bool
+	Signature   string
+	SigError    string
+	Meta        []htmlMeta
+	Body        string
+}
+
+// HTML writes the conversation as a standalone HTML page. Everything from
+// the envelopes is escaped.
+func (c *Conversation) HTML(w io.Writer) error {
+	inPage := make(map[string]bool, len(c.Messages))
+	for _, m := range c.Messages {
+		inPage[m.Envelope.ID] = true
+	}
+	page := struct {
+		Title        string
+		Exported     string
+		Participants []string
+		Messages     []htmlMessage
+	}{
+		Title:        c.Title,
+		Exported:     c.Exported.Format(timeLayout),
+		Participants: c.Participants(),
+	}
+	for _, m := range c.Messages {
+		env := m.Envelope
+		t := time.Unix(env.Ts, 0)
+		hm := htmlMessage{
+			Mailbox:     string(m.Mailbox),
+			ID:          env.ID,
+			From:        c.Name(env.From),
+			To:          c.Name(env.To),
+			Time:        t.Format(timeLayout),
+			ISOTime:     t.Format(time.RFC3339),
+			Type:        env.Type,
+			ReplyTo:     env.ReplyTo,
+			ReplyInPage: inPage[env.ReplyTo],
+			Signature:   m.Signature,
+			SigError:    m.SigError,
+			Body:        env.Body,
+		}
+		for _, k := range sortedKeys(env.Meta) {
+			hm.Meta = append(hm.Meta, htmlMeta{Key: k, Value: env.Meta[k]})
+		}
+		page.Messages = append(page.Messages, hm)
+	}
+	if err := htmlPage.Execute(w, page); err != nil {
+		return fmt.Errorf("write html: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// subjectWidth is how much of a body's first line becomes the Subject.
+const subjectWidth = 72
+
+// Maildir writes each message as an RFC 5322 mail into the Maildir at dir,
+// creating it if needed, and returns how many were added. File names are
+// derived from the message, so exporting again skips messages already there.
+func (c *Conversation) Maildir(dir string) (int, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return 0, fmt.Errorf("create maildir: %w", err)
+		}
+	}
+	added := 0
+	for _, m := range c.Messages {
+		// The sender is part of the name since IDs repeat across senders.
+		// Read messages carry the Seen flag; mail clients show the rest as new.
+		name := fmt.Sprintf("%d.%s.%s.holler", m.Envelope.Ts, EscapeID(m.Envelope.ID), EscapeID(m.Envelope.From))
+		flags := ":2,"
+		if m.Read {
+			flags += "S"
+		}
+		path := filepath.Join(dir, "cur", name+flags)
+		if exported(dir, name) {
+			continue
+		}
+		// Deliver the Maildir way: write in tmp, then rename into place.
+		tmp := filepath.Join(dir, "tmp", name)
+		if err := os.WriteFile(tmp, c.mail(m), 0600); err != nil {
+			return added, fmt.Errorf("write %s: %w", tmp, err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			return added, fmt.Errorf("write %s: %w", path, err)
+		}
+		added++
+	}
+	return added, nil
+}
+
+// exported reports whether the message with this file name is already in
+// the Maildir. A mail client may since have moved it or changed its flags.
+func exported(dir, name string) bool {
+	for _, sub := range []string{"new", "cur"} {
+		if found, _ := filepath.Glob(filepath.Join(dir, sub, name+"*")); len(found) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// mail renders m as an RFC 5322 message. ReplyTo becomes In-Reply-To and
+// the thread is carried in References, so clients thread the conversation.
+func (c *Conversation) mail(m Message) []byte {
+	env := m.Envelope
+	var b bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&b, "%s: %s\n", name, value)
+	}
+
+	header("From", c.address(env.From))
+	header("To", c.address(env.To))
+	header("Date", time.Unix(env.Ts, 0).Format(time.RFC1123Z))
+	subject := summary(env.Body, subjectWidth)
+	if env.Type != "message" {
+		subject = "[" + env.Type + "] " + subject
+	}
+	header("Subject", encodeHeader(subject))
+	header("Message-ID", messageID(env.ID))
+	if env.ReplyTo != "" {
+		header("In-Reply-To", messageID(env.ReplyTo))
+	}
+	var refs []string
+	if env.ThreadID != "" && env.ThreadID != env.ID && env.ThreadID != env.ReplyTo {
+		refs = append(refs, messageID(env.ThreadID))
+	}
+	if env.ReplyTo != "" {
+		refs = append(refs, messageID(env.ReplyTo))
+	}
+	if len(refs) > 0 {
+		header("References", strings.Join(refs, " "))
+	}
+	header("X-Holler-Type", encodeHeader(env.Type))
+	if env.ThreadID != "" {
+		header("X-Holler-Thread", encodeHeader(env.ThreadID))
+	}
+	sig := m.Signature
+	if m.SigError != "" {
+		sig += " (" + m.SigError + ")"
+	}
+	header("X-Holler-Signature", encodeHeader(sig))
+	for _, k := range sortedKeys(env.Meta) {
+		header("X-Holler-Meta", encodeHeader(k+"="+env.Meta[k]))
+	}
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "8bit")
+	b.WriteString("\n")
+	b.WriteString(strings.ReplaceAll(env.Body, "\r\n", "\n"))
+	if !strings.HasSuffix(env.Body, "\n") {
+		b.WriteString("\n")
+	}
+	return b.Bytes()
+}
+
+// address renders an onion address as a mailbox whose domain is the onion
+// service, with its display name.
+func (c *Conversation) address(addr string) string {
+	a := mail.Address{Name: c.Name(addr), Address: "holler@" + EscapeID(addr) + ".onion"}
+	return a.String()
+}
+
+// messageID turns a holler message ID into a Message-ID.
+func messageID(id string) string {
+	return "<" + EscapeID(id) + "@holler>"
+}
+
+// encodeHeader makes s safe as a header value: line breaks are flattened
+// and anything outside printable ASCII is MIME-encoded.
+func encodeHeader(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	return mime.QEncoding.Encode("utf-8", s)
+}
@@ -0,0 +1,71 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// timeLayout is how export renders message times.
+const timeLayout = "2006-01-02 15:04:05 MST"
+
+// Markdown writes the conversation as a Markdown document. Bodies go in
+// fenced blocks so they show exactly as sent.
+func (c *Conversation) Markdown(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# %s\n\n", c.Title)
+	fmt.Fprintf(bw, "Exported %s · %d message(s) · %s\n", c.Exported.Format(timeLayout), len(c.Messages), strings.Join(c.Participants(), ", "))
+
+	for _, m := range c.Messages {
+		env := m.Envelope
+		fmt.Fprintf(bw, "\n---\n\n### %s → %s · %s\n\n", c.Name(env.From), c.Name(env.To), time.Unix(env.Ts, 0).Format(timeLayout))
+
+		facts := []string{"`" + env.ID + "`", "type `" + env.Type + "`"}
+		if env.ReplyTo != "" {
+			facts = append(facts, "reply to `"+env.ReplyTo+"`")
+		}
+		if env.ThreadID != "" && env.ThreadID != env.ID {
+			facts = append(facts, "thread `"+env.ThreadID+"`")
+		}
+		facts = append(facts, "signature "+sigLabel(m))
+		fmt.Fprintf(bw, "%s\n\n", strings.Join(facts, " · "))
+		for _, k := range sortedKeys(env.Meta) {
+			fmt.Fprintf(bw, "- `%s`: `%s`\n", k, env.Meta[k])
+		}
+		if len(env.Meta) > 0 {
+			fmt.Fprintln(bw)
+		}
+
+		fence := codeFence(env.Body)
+		fmt.Fprintf(bw, "%stext\n%s\n%s\n", fence, strings.TrimRight(env.Body, "\n"), fence)
+	}
+	return bw.Flush()
+}
+
+// sigLabel describes m's signature check for people.
+func sigLabel(m Message) string {
+	switch m.Signature {
+	case SigVerified:
+		return "✅ verified"
+	case SigInvalid:
+		return "❌ INVALID"
+	default:
+		return "⚠️ not checked (" + m.SigError + ")"
+	}
+}
+
+// codeFence returns a backtick fence longer than any backtick run in body.
+func codeFence(body string) string {
+	longest, run := 0, 0
+	for _, r := range body {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
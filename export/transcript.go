@@ -0,0 +1,137 @@
+package export
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// SelfRole tags our own turns in a transcript.
+const SelfRole = "self"
+
+// truncatedMark ends a turn cut to fit the budget.
+const truncatedMark = "\n[truncated]\n\n"
+
+// omittedReserve is kept free for the note on omitted turns.
+const omittedReserve = 40
+
+// Summarizer condenses the transcript of older turns to at most maxChars
+// characters. An empty result means no summary.
+type Summarizer func(transcript string, turns, maxChars int) string
+
+// Transcript renders the conversation compactly for a language model
+// prompt: one turn per message, tagged with who spoke ("self" for us),
+// when, and the type, IDs and meta inline. With maxChars above zero the
+// newest turns that fit are kept whole, and the older ones are replaced by
+// what summarize makes of them or, failing that, a note saying how many
+// were left out.
+func (c *Conversation) Transcript(maxChars int, summarize Summarizer) string {
+	header := c.transcriptHeader()
+	turns := make([]string, len(c.Messages))
+	for i, m := range c.Messages {
+		turns[i] = c.turn(m)
+	}
+	full := header + strings.Join(turns, "")
+	if maxChars <= 0 || utf8.RuneCountInString(full) <= maxChars {
+		return full
+	}
+
+	budget := maxChars - utf8.RuneCountInString(header) - omittedReserve
+	keep, used := len(turns), 0
+	for keep > 0 && used+utf8.RuneCountInString(turns[keep-1]) <= budget {
+		keep--
+		used += utf8.RuneCountInString(turns[keep])
+	}
+	if keep == len(turns) {
+		// Not even the newest turn fits: keep its tag and the start of its
+		// body, if there's room for that much.
+		tag, body, _ := strings.Cut(turns[keep-1], "\n")
+		if room := budget - utf8.RuneCountInString(tag) - 1 - len(truncatedMark); room > 0 {
+			keep--
+			turns[keep] = tag + "\n" + truncate(body, room) + truncatedMark
+			used = utf8.RuneCountInString(turns[keep])
+		}
+	}
+
+	var older string
+	if keep > 0 {
+		tag := fmt.Sprintf("[summary of %d earlier turn(s)]\n", keep)
+		room := maxChars - utf8.RuneCountInString(header) - used - len(tag) - 2
+		if summarize != nil && room > 0 {
+			if s := strings.TrimSpace(summarize(header+strings.Join(turns[:keep], ""), keep, room)); s != "" {
+				older = tag + truncate(s, room) + "\n\n"
+			}
+		}
+		if older == "" {
+			older = fmt.Sprintf("[%d earlier turn(s) omitted]\n\n", keep)
+		}
+	}
+	return truncate(header+older+strings.Join(turns[keep:], ""), maxChars)
+}
+
+// transcriptHeader names the conversation and who is in it.
+func (c *Conversation) transcriptHeader() string {
+	seen := make(map[string]bool)
+	var who []string
+	for _, m := range c.Messages {
+		for _, addr := range []string{m.Envelope.From, m.Envelope.To} {
+			if seen[addr] {
+				continue
+			}
+			seen[addr] = true
+			who = append(who, c.role(addr)+"="+addr+".onion")
+		}
+	}
+	return fmt.Sprintf("# %s\n# participants: %s\n\n", c.Title, strings.Join(who, ", "))
+}
+
+// turn renders one message: a tag line, the body, and a blank line.
+func (c *Conversation) turn(m Message) string {
+	env := m.Envelope
+	tag := []string{c.role(env.From), time.Unix(env.Ts, 0).Format("2006-01-02 15:04")}
+	if env.Type != "message" {
+		tag = append(tag, env.Type)
+	}
+	tag = append(tag, "id "+shortID(env.ID))
+	if env.ReplyTo != "" {
+		tag = append(tag, "reply to "+shortID(env.ReplyTo))
+	}
+	if len(env.Meta) > 0 {
+		pairs := make([]string, 0, len(env.Meta))
+		for _, k := range sortedKeys(env.Meta) {
+			pairs = append(pairs, k+"="+env.Meta[k])
+		}
+		tag = append(tag, "meta "+strings.Join(pairs, " "))
+	}
+	if m.Signature != SigVerified {
+		tag = append(tag, "UNVERIFIED")
+	}
+	return fmt.Sprintf("[%s]\n%s\n\n", strings.Join(tag, ", "), strings.TrimSpace(env.Body))
+}
+
+// role returns the tag for addr's turns.
+func (c *Conversation) role(addr string) string {
+	if addr == c.Self {
+		return SelfRole
+	}
+	return c.Name(addr)
+}
+
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+// truncate cuts s to at most n characters.
+func truncate(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
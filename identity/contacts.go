@@ -69,7 +69,8 @@ func LoadContacts() (Contacts, error) {
 	return c, nil
 }
 
-// SaveContacts writes contacts to disk.
+// SaveContacts writes contacts to disk, replacing the file atomically so a
+// running daemon never reads it half-written.
 func SaveContacts(c Contacts) error {
 	path, err := ContactsPath()
 	if err != nil {
@@ -79,7 +80,11 @@ func SaveContacts(c Contacts) error {
 	if err != nil {
 		return fmt.Errorf("marshal contacts: %w", err)
 	}
-	return os.WriteFile(path, data, 0644)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write contacts: %w", err)
+	}
+	return os.Rename(tmp, path)
 }
 
 // Resolve tries to resolve an alias to an onion address.
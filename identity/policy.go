@@ -0,0 +1,182 @@
+package identity
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/1F47E/holler/message"
+)
+
+const policyFile = "policy.json"
+
+// ErrTooLarge is wrapped by Check when a body exceeds the sender's limit.
+var ErrTooLarge = errors.New("too large")
+
+// Policy modes.
+const (
+	PolicyOpen       = "open"       // accept messages from anyone (default)
+	PolicyContacts   = "contacts"   // accept messages only from saved contacts
+	PolicyQuarantine = "quarantine" // hold messages from unknown senders in requests.jsonl
+)
+
+// Policy is the ~/.holler/policy.json format. It decides which senders and
+// message types the receive path accepts.
+type Policy struct {
+	Mode          string          `json:"mode"`
+	Blocked       []string        `json:"blocked,omitempty"`        // onion addresses, always rejected
+	Rules         map[string]Rule `json:"rules,omitempty"`          // onion address → per-sender rule
+	PoWDifficulty int             `json:"pow_difficulty,omitempty"` // leading zero bits required from non-contacts
+}
+
+// Rule restricts what a single sender may deliver.
+type Rule struct {
+	Types   []string `json:"types,omitempty"`    // accepted message types (empty = any)
+	MaxBody int      `json:"max_body,omitempty"` // maximum body size in bytes (0 = no limit)
+}
+
+// PolicyPath returns the path to ~/.holler/policy.json.
+func PolicyPath() (string, error) {
+	dir, err := HollerDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, policyFile), nil
+}
+
+// LoadPolicy reads the policy from disk. Returns an open policy if the file
+// doesn't exist.
+func LoadPolicy() (*Policy, error) {
+	path, err := PolicyPath()
+	if err != nil {
+		return nil, err
+	}
+	p := &Policy{Mode: PolicyOpen}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read policy: %w", err)
+	}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("parse policy: %w", err)
+	}
+	if p.Mode == "" {
+		p.Mode = PolicyOpen
+	}
+	return p, nil
+}
+
+// SavePolicy writes the policy to disk, replacing the file atomically so a
+// running daemon never reads it half-written.
+func SavePolicy(p *Policy) error {
+	path, err := PolicyPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal policy: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write policy: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// ValidPolicyMode reports whether mode is a known policy mode.
+func ValidPolicyMode(mode string) bool {
+	return mode == PolicyOpen || mode == PolicyContacts || mode == PolicyQuarantine
+}
+
+// Quarantines reports whether a message from onionAddr should be held for
+// review instead of delivered: quarantine mode and the sender isn't a contact.
+// Pings and receipts are never held; they carry nothing to review.
+func (p *Policy) Quarantines(onionAddr, msgType string, contacts Contacts) bool {
+	if p.Mode != PolicyQuarantine || msgType == "ping" || message.IsReceipt(msgType) {
+		return false
+	}
+	_, known := contacts.FindByOnion(onionAddr)
+	return !known
+}
+
+// RequiredPoW returns the proof-of-work difficulty demanded from onionAddr:
+// the configured difficulty for strangers, 0 for contacts.
+func (p *Policy) RequiredPoW(onionAddr string, contacts Contacts) int {
+	if p.PoWDifficulty <= 0 {
+		return 0
+	}
+	if _, known := contacts.FindByOnion(onionAddr); known {
+		return 0
+	}
+	return p.PoWDifficulty
+}
+
+// IsBlocked reports whether onionAddr is on the block list.
+func (p *Policy) IsBlocked(onionAddr string) bool {
+	for _, b := range p.Blocked {
+		if b == onionAddr {
+			return true
+		}
+	}
+	return false
+}
+
+// Block adds onionAddr to the block list. Returns false if already blocked.
+func (p *Policy) Block(onionAddr string) bool {
+	if p.IsBlocked(onionAddr) {
+		return false
+	}
+	p.Blocked = append(p.Blocked, onionAddr)
+	sort.Strings(p.Blocked)
+	return true
+}
+
+// Unblock removes onionAddr from the block list. Returns false if it wasn't blocked.
+func (p *Policy) Unblock(onionAddr string) bool {
+	for i, b := range p.Blocked {
+		if b == onionAddr {
+			p.Blocked = append(p.Blocked[:i], p.Blocked[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Check decides whether a message from onionAddr of the given type and body
+// size is accepted. The returned error is the human-readable reason.
+func (p *Policy) Check(onionAddr, msgType string, bodyLen int, contacts Contacts) error {
+	if p.IsBlocked(onionAddr) {
+		return fmt.Errorf("sender is blocked")
+	}
+	if p.Mode == PolicyContacts {
+		if _, known := contacts.FindByOnion(onionAddr); !known {
+			return fmt.Errorf("only contacts may send messages")
+		}
+	}
+	rule, ok := p.Rules[onionAddr]
+	if !ok {
+		return nil
+	}
+	if len(rule.Types) > 0 && !containsString(rule.Types, msgType) {
+		return fmt.Errorf("message type %q not accepted", msgType)
+	}
+	if rule.MaxBody > 0 && bodyLen > rule.MaxBody {
+		return fmt.Errorf("%w: body of %d bytes exceeds limit of %d", ErrTooLarge, bodyLen, rule.MaxBody)
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package message
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const deadLetterFile = "deadletter.jsonl"
+
+// DeadLetter is an outbox message that could not be delivered, kept with the
+// reason it was given up on and its delivery history.
+type DeadLetter struct {
+	Envelope *Envelope       `json:"envelope"`
+	Attempts int             `json:"attempts"`
+	Reason   string          `json:"reason"` // final error
+	Failed   int64           `json:"failed"` // unix time it was given up on
+	History  []DeliveryEvent `json:"history,omitempty"`
+}
+
+// DeadLetterPath returns the path to ~/.holler/deadletter.jsonl.
+func DeadLetterPath(hollerDir string) string {
+	return filepath.Join(hollerDir, deadLetterFile)
+}
+
+// AppendToDeadLetter adds an undeliverable message to the dead-letter queue.
+func AppendToDeadLetter(hollerDir string, dl DeadLetter) error {
+	data, err := json.Marshal(dl)
+	if err != nil {
+		return fmt.Errorf("marshal dead letter: %w", err)
+	}
+	return appendToFile(DeadLetterPath(hollerDir), data)
+}
+
+// LoadDeadLetters reads the dead-letter queue, oldest first.
+func LoadDeadLetters(hollerDir string) ([]DeadLetter, error) {
+	f, err := os.Open(DeadLetterPath(hollerDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open dead letters: %w", err)
+	}
+	defer f.Close()
+
+	var letters []DeadLetter
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 2<<20) // envelope plus history
+	for scanner.Scan() {
+		var dl DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &dl); err != nil || dl.Envelope == nil {
+			continue // skip corrupt lines
+		}
+		letters = append(letters, dl)
+	}
+	return letters, scanner.Err()
+}
+
+// UpdateDeadLetters replaces the dead-letter queue with what fn returns for
+// its current letters, holding the queue's lock so letters added meanwhile
+// aren't lost. fn must not call other dead-letter functions. An error from
+// fn leaves the queue unchanged.
+func UpdateDeadLetters(hollerDir string, fn func([]DeadLetter) ([]DeadLetter, error)) error {
+	return withLock(DeadLetterPath(hollerDir), func() error {
+		letters, err := LoadDeadLetters(hollerDir)
+		if err != nil {
+			return err
+		}
+		if letters, err = fn(letters); err != nil {
+			return err
+		}
+		return writeDeadLetters(hollerDir, letters)
+	})
+}
+
+// writeDeadLetters atomically overwrites the dead-letter queue. Callers must
+// hold the queue's lock.
+func writeDeadLetters(hollerDir string, letters []DeadLetter) error {
+	path := DeadLetterPath(hollerDir)
+	if len(letters) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("create dead letter tmp: %w", err)
+	}
+	for _, dl := range letters {
+		data, err := json.Marshal(dl)
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return fmt.Errorf("marshal dead letter: %w", err)
+		}
+		if _, err := f.Write(append(data, '\n')); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return fmt.Errorf("write dead letter: %w", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("close dead letter tmp: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,158 @@
+package message
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const deliveriesFile = "deliveries.jsonl"
+
+// OutboxTTL is how long an undelivered message is retried. It matches the
+// receiver's default maximum message age, past which it would be refused.
+const OutboxTTL = 72 * time.Hour
+
+// Delivery lifecycle events.
+const (
+	DeliveryQueued    = "queued"    // waiting in the outbox
+	DeliveryAttempt   = "attempt"   // a delivery attempt failed; Error says why
+	DeliveryDelivered = "delivered" // the recipient acked it
+	DeliveryFailed    = "failed"    // permanently rejected or out of retries
+	DeliveryExpired   = "expired"   // older than OutboxTTL before it got through
+	DeliveryCancelled = "cancelled" // removed from the outbox by the user
+)
+
+// DeliveryEvent is one line of deliveries.jsonl: a step in the life of an
+// outgoing message.
+type DeliveryEvent struct {
+	ID      string `json:"id"` // message ID
+	To      string `json:"to"`
+	Event   string `json:"event"`
+	Ts      int64  `json:"ts"`
+	Attempt int    `json:"attempt,omitempty"`
+	Error   string `json:"error,omitempty"`
+	AckType string `json:"ack_type,omitempty"` // ack, received, or nack for a duplicate
+	AckID   string `json:"ack_id,omitempty"`
+	AckSig  string `json:"ack_sig,omitempty"` // the recipient's signature over the ack
+}
+
+// DeliveriesPath returns the path to ~/.holler/deliveries.jsonl.
+func DeliveriesPath(hollerDir string) string {
+	return filepath.Join(hollerDir, deliveriesFile)
+}
+
+// RecordDelivery appends a lifecycle event for env. ack, if not nil, is the
+// recipient's reply proving delivery.
+func RecordDelivery(hollerDir string, env *Envelope, event string, attempt int, deliveryErr error, ack *Envelope) error {
+	return AppendDelivery(hollerDir, NewDeliveryEvent(env, event, attempt, deliveryErr, ack))
+}
+
+// NewDeliveryEvent returns a lifecycle event for env, as RecordDelivery
+// would record it.
+func NewDeliveryEvent(env *Envelope, event string, attempt int, deliveryErr error, ack *Envelope) DeliveryEvent {
+	ev := DeliveryEvent{
+		ID:      env.ID,
+		To:      env.To,
+		Event:   event,
+		Ts:      time.Now().Unix(),
+		Attempt: attempt,
+	}
+	if deliveryErr != nil {
+		ev.Error = deliveryErr.Error()
+	}
+	if ack != nil {
+		ev.AckType, ev.AckID, ev.AckSig = ack.Type, ack.ID, ack.Sig
+	}
+	return ev
+}
+
+// AppendDelivery appends ev to deliveries.jsonl.
+func AppendDelivery(hollerDir string, ev DeliveryEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("marshal delivery event: %w", err)
+	}
+	return appendToFile(DeliveriesPath(hollerDir), data)
+}
+
+// LoadDeliveries reads all lifecycle events, oldest first.
+func LoadDeliveries(hollerDir string) ([]DeliveryEvent, error) {
+	f, err := os.Open(DeliveriesPath(hollerDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open deliveries: %w", err)
+	}
+	defer f.Close()
+
+	var events []DeliveryEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev DeliveryEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			continue // skip corrupt lines
+		}
+		events = append(events, ev)
+	}
+	return events, scanner.Err()
+}
+
+// DeliveryStatus is the current state of one outgoing message.
+type DeliveryStatus struct {
+	ID        string   `json:"id"`
+	To        string   `json:"to"`
+	State     string   `json:"state"` // the latest lifecycle event
+	Attempts  int      `json:"attempts"`
+	LastError string   `json:"last_error,omitempty"`
+	Updated   int64    `json:"updated"`
+	Receipts  []string `json:"receipts,omitempty"` // receipt types received, in order
+}
+
+// Terminal reports whether the message's fate is settled.
+func (s *DeliveryStatus) Terminal() bool {
+	switch s.State {
+	case DeliveryDelivered, DeliveryFailed, DeliveryExpired, DeliveryCancelled:
+		return true
+	}
+	return false
+}
+
+// deliveryKey identifies an outgoing message. Caller-supplied IDs repeat
+// across peers, so the recipient is part of it.
+type deliveryKey struct {
+	to, id string
+}
+
+// DeliveryStatuses folds events and receipts into one status per message,
+// in order of first appearance. Only receipts from a message's recipient
+// count: anyone can sign a receipt naming one of our message IDs.
+func DeliveryStatuses(events []DeliveryEvent, receipts []*Envelope) []*DeliveryStatus {
+	var order []*DeliveryStatus
+	byKey := make(map[deliveryKey]*DeliveryStatus)
+	for _, ev := range events {
+		key := deliveryKey{ev.To, ev.ID}
+		st, ok := byKey[key]
+		if !ok {
+			st = &DeliveryStatus{ID: ev.ID, To: ev.To}
+			byKey[key] = st
+			order = append(order, st)
+		}
+		st.State, st.Updated = ev.Event, ev.Ts
+		if ev.Attempt > st.Attempts {
+			st.Attempts = ev.Attempt
+		}
+		if ev.Error != "" {
+			st.LastError = ev.Error
+		}
+	}
+	for _, r := range receipts {
+		if st, ok := byKey[deliveryKey{r.From, r.Body}]; ok {
+			st.Receipts = append(st.Receipts, r.Type)
+		}
+	}
+	return order
+}
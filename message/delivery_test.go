@@ -0,0 +1,34 @@
+package message
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestDeliveryStatusesPerPeer checks that a caller-supplied ID sent to two
+// peers gets a status for each, with only that peer's receipts.
+func TestDeliveryStatusesPerPeer(t *testing.T) {
+	events := []DeliveryEvent{
+		{ID: "job-1", To: "alice", Event: DeliveryQueued, Ts: 1},
+		{ID: "job-1", To: "bob", Event: DeliveryQueued, Ts: 2},
+		{ID: "job-1", To: "bob", Event: DeliveryDelivered, Ts: 3, Attempt: 2},
+	}
+	receipts := []*Envelope{
+		{Type: ReceiptReceived, From: "bob", Body: "job-1"},
+		{Type: ReceiptRead, From: "bob", Body: "job-1"},
+		{Type: ReceiptRead, From: "mallory", Body: "job-1"},
+	}
+
+	statuses := DeliveryStatuses(events, receipts)
+	if len(statuses) != 2 {
+		t.Fatalf("got %d statuses, want 2", len(statuses))
+	}
+	alice, bob := statuses[0], statuses[1]
+	if alice.To != "alice" || alice.State != DeliveryQueued || len(alice.Receipts) != 0 {
+		t.Errorf("alice: %+v", alice)
+	}
+	want := []string{ReceiptReceived, ReceiptRead}
+	if bob.To != "bob" || bob.State != DeliveryDelivered || bob.Attempts != 2 || !slices.Equal(bob.Receipts, want) {
+		t.Errorf("bob: %+v, want delivered after 2 attempts with receipts %v", bob, want)
+	}
+}
@@ -1,9 +1,14 @@
 package message
 
 import (
+	"bytes"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"maps"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/cretz/bine/torutil"
@@ -11,10 +16,27 @@ import (
 	"github.com/google/uuid"
 )
 
+// Signature scheme versions. V1 concatenates fields without separators and
+// V2 length-prefixes them. Peers that predate V2 reject V2 envelopes, so
+// new envelopes are signed as V1 until the recipient is known to verify V2.
+const (
+	V1 = 1
+	V2 = 2
+
+	CurrentVersion = V2 // highest version Verify accepts
+)
+
+// sigDomainV2 prefixes every v2 signing payload so the signature can't be
+// replayed as a signature over some other holler structure.
+const sigDomainV2 = "holler-sig-v2\x00"
+
 // Envelope is the JSONL message format for holler.
 //
 // Type can be: message, ack, ping, task-proposal, task-result,
 // capability-query, status-update, or any custom string.
+//
+// Fields this version doesn't know about are kept in Extra and written back
+// on Marshal, so envelopes from newer peers still verify and re-serialize intact.
 type Envelope struct {
 	V        int               `json:"v"`
 	ID       string            `json:"id"`
@@ -26,13 +48,25 @@ type Envelope struct {
 	ReplyTo  string            `json:"reply_to,omitempty"`
 	ThreadID string            `json:"thread_id,omitempty"`
 	Meta     map[string]string `json:"meta,omitempty"`
+	PoW      string            `json:"pow,omitempty"` // proof-of-work stamp, see MintPoW
 	Sig      string            `json:"sig"`
+
+	Extra map[string]json.RawMessage `json:"-"` // unknown fields, covered by v2 signatures
 }
 
-// NewEnvelope creates a new unsigned envelope with onion addresses.
+// knownFields are the JSON keys decoded into Envelope's typed fields.
+var knownFields = map[string]bool{
+	"v": true, "id": true, "from": true, "to": true, "ts": true, "type": true, "body": true,
+	"reply_to": true, "thread_id": true, "meta": true, "pow": true, "sig": true,
+}
+
+// envelopeFields has Envelope's layout without its JSON methods.
+type envelopeFields Envelope
+
+// NewEnvelope creates a new unsigned V1 envelope with onion addresses.
 func NewEnvelope(fromOnion, toOnion string, msgType, body string) *Envelope {
 	return &Envelope{
-		V:    1,
+		V:    V1,
 		ID:   uuid.New().String(),
 		From: fromOnion,
 		To:   toOnion,
@@ -42,8 +76,37 @@ func NewEnvelope(fromOnion, toOnion string, msgType, body string) *Envelope {
 	}
 }
 
-// signPayload returns the bytes to sign: id+from+to+ts+type+body+reply_to+meta.
+// maxIDLen bounds caller-supplied envelope IDs.
+const maxIDLen = 128
+
+// ValidID reports whether id can be used as a caller-supplied envelope ID:
+// 1 to 128 ASCII letters, digits, '.', '_', ':' or '-'.
+func ValidID(id string) bool {
+	if id == "" || len(id) > maxIDLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '.', c == '_', c == ':', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// signPayload returns the bytes to sign for the envelope's version.
 func (e *Envelope) signPayload() []byte {
+	if e.V >= V2 {
+		return e.signPayloadV2()
+	}
+	return e.signPayloadV1()
+}
+
+// signPayloadV1 returns id+from+to+ts+type+body+reply_to+thread_id+meta.
+// Field boundaries are ambiguous; kept only to verify v1 envelopes.
+func (e *Envelope) signPayloadV1() []byte {
 	payload := fmt.Sprintf("%s%s%s%d%s%s%s%s", e.ID, e.From, e.To, e.Ts, e.Type, e.Body, e.ReplyTo, e.ThreadID)
 	if len(e.Meta) > 0 {
 		if metaJSON, err := json.Marshal(e.Meta); err == nil {
@@ -53,6 +116,58 @@ func (e *Envelope) signPayload() []byte {
 	return []byte(payload)
 }
 
+// signPayloadV2 returns the domain prefix followed by every field except
+// pow and sig, each length-prefixed. Meta entries and unknown fields follow
+// as counted, key-sorted pairs; unknown values are compacted JSON.
+func (e *Envelope) signPayloadV2() []byte {
+	var b bytes.Buffer
+	b.WriteString(sigDomainV2)
+	for _, f := range []string{
+		strconv.Itoa(e.V), e.ID, e.From, e.To, strconv.FormatInt(e.Ts, 10),
+		e.Type, e.Body, e.ReplyTo, e.ThreadID,
+	} {
+		writeField(&b, []byte(f))
+	}
+
+	keys := make([]string, 0, len(e.Meta))
+	for k := range e.Meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	writeCount(&b, len(keys))
+	for _, k := range keys {
+		writeField(&b, []byte(k))
+		writeField(&b, []byte(e.Meta[k]))
+	}
+
+	keys = keys[:0]
+	for k := range e.Extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	writeCount(&b, len(keys))
+	for _, k := range keys {
+		var v bytes.Buffer
+		if err := json.Compact(&v, e.Extra[k]); err != nil {
+			v.Write(e.Extra[k])
+		}
+		writeField(&b, []byte(k))
+		writeField(&b, v.Bytes())
+	}
+	return b.Bytes()
+}
+
+func writeCount(b *bytes.Buffer, n int) {
+	var n4 [4]byte
+	binary.BigEndian.PutUint32(n4[:], uint32(n))
+	b.Write(n4[:])
+}
+
+func writeField(b *bytes.Buffer, f []byte) {
+	writeCount(b, len(f))
+	b.Write(f)
+}
+
 // Sign signs the envelope with a bine ed25519 keypair.
 func (e *Envelope) Sign(kp bineed25519.KeyPair) error {
 	sig := bineed25519.Sign(kp, e.signPayload())
@@ -62,7 +177,11 @@ func (e *Envelope) Sign(kp bineed25519.KeyPair) error {
 
 // Verify verifies the envelope signature using the sender's onion address.
 // Extracts the ed25519 public key from the From field (56-char onion service ID).
+// Both v1 and v2 envelopes are accepted.
 func (e *Envelope) Verify() (bool, error) {
+	if e.V > CurrentVersion {
+		return false, fmt.Errorf("unsupported envelope version %d", e.V)
+	}
 	pubKey, err := PubKeyFromOnion(e.From)
 	if err != nil {
 		return false, fmt.Errorf("extract public key from onion address: %w", err)
@@ -74,11 +193,81 @@ func (e *Envelope) Verify() (bool, error) {
 	return pubKey.Verify(e.signPayload(), sig), nil
 }
 
+// Key identifies the envelope among all messages sent and received. IDs are
+// chosen by senders, so only the sender and ID together are unique.
+func (e *Envelope) Key() string {
+	return e.From + "/" + e.ID
+}
+
+// SameMessage reports whether e and other carry the same message: sender,
+// recipient, ID, type, body, reply_to, thread_id and meta all match. The
+// version, timestamp, proof-of-work and signature may differ, since a sender
+// re-signs a message it retries whenever the peer's signature version
+// changes or the message is requeued.
+func (e *Envelope) SameMessage(other *Envelope) bool {
+	return e.From == other.From && e.To == other.To && e.ID == other.ID &&
+		e.Type == other.Type && e.Body == other.Body &&
+		e.ReplyTo == other.ReplyTo && e.ThreadID == other.ThreadID &&
+		maps.Equal(e.Meta, other.Meta)
+}
+
 // PubKeyFromOnion extracts the ed25519 public key from a 56-char onion service ID.
 func PubKeyFromOnion(onionAddr string) (bineed25519.PublicKey, error) {
 	return torutil.PublicKeyFromV3OnionServiceID(onionAddr)
 }
 
+// MarshalJSON encodes the envelope's fields followed by any unknown fields
+// preserved from decoding, in key order.
+func (e Envelope) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(envelopeFields(e))
+	if err != nil || len(e.Extra) == 0 {
+		return data, err
+	}
+	keys := make([]string, 0, len(e.Extra))
+	for k := range e.Extra {
+		if !knownFields[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var b bytes.Buffer
+	b.Write(data[:len(data)-1]) // drop the closing brace
+	for _, k := range keys {
+		key, _ := json.Marshal(k)
+		var v bytes.Buffer
+		if err := json.Compact(&v, e.Extra[k]); err != nil {
+			return nil, fmt.Errorf("marshal envelope field %q: %w", k, err)
+		}
+		b.WriteByte(',')
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(v.Bytes())
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// UnmarshalJSON decodes the known fields and keeps everything else in Extra.
+func (e *Envelope) UnmarshalJSON(data []byte) error {
+	var f envelopeFields
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+	for k := range knownFields {
+		delete(all, k)
+	}
+	if len(all) > 0 {
+		f.Extra = all
+	}
+	*e = Envelope(f)
+	return nil
+}
+
 // Marshal serializes the envelope to JSON bytes (single line, no trailing newline).
 func (e *Envelope) Marshal() ([]byte, error) {
 	return json.Marshal(e)
@@ -0,0 +1,157 @@
+package message
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cretz/bine/torutil"
+	bineed25519 "github.com/cretz/bine/torutil/ed25519"
+)
+
+// testKey returns a fresh keypair and its onion address.
+func testKey(t *testing.T) (bineed25519.KeyPair, string) {
+	t.Helper()
+	kp, err := bineed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kp, strings.ToLower(torutil.OnionServiceIDFromPrivateKey(kp))
+}
+
+// TestVerifyFieldBoundaries checks that moving bytes from one field into its
+// neighbour keeps a v1 signature valid but breaks a v2 one.
+func TestVerifyFieldBoundaries(t *testing.T) {
+	kp, from := testKey(t)
+	tests := []struct {
+		name  string
+		forge func(*Envelope)
+	}{
+		{"ts into type", func(e *Envelope) { e.Ts, e.Type = 1, "7message" }},
+		{"type into body", func(e *Envelope) { e.Type, e.Body = "messageh", "ello" }},
+		{"body into reply_to", func(e *Envelope) { e.Body, e.ReplyTo = "hell", "or1" }},
+		{"reply_to into thread_id", func(e *Envelope) { e.ReplyTo, e.ThreadID = "r", "1t1" }},
+		{"meta into thread_id", func(e *Envelope) { e.ThreadID, e.Meta = `t1{"a":"b"}`, nil }},
+	}
+	for _, v := range []int{V1, V2} {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("v%d %s", v, tt.name), func(t *testing.T) {
+				orig := NewEnvelope(from, from, "message", "hello")
+				orig.V, orig.Ts = v, 17
+				orig.ReplyTo, orig.ThreadID = "r1", "t1"
+				orig.Meta = map[string]string{"a": "b"}
+				if err := orig.Sign(kp); err != nil {
+					t.Fatal(err)
+				}
+				forged := *orig
+				tt.forge(&forged)
+				if !bytes.Equal(forged.signPayloadV1(), orig.signPayloadV1()) {
+					t.Fatal("forgery doesn't collide under v1")
+				}
+
+				ok, err := forged.Verify()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := v == V1; ok != want {
+					t.Errorf("v%d: forged envelope verifies %v, want %v", v, ok, want)
+				}
+			})
+		}
+	}
+}
+
+// TestVerifyExtraFields checks that fields unknown to this version survive
+// a decode and encode, stay covered by a v2 signature, and can't be
+// changed, stripped or added to without breaking it.
+func TestVerifyExtraFields(t *testing.T) {
+	kp, from := testKey(t)
+	env := NewEnvelope(from, from, "message", "hello")
+	env.V = V2
+	env.Extra = map[string]json.RawMessage{"priority": json.RawMessage(`{"level": 2}`)}
+	if err := env.Sign(kp); err != nil {
+		t.Fatal(err)
+	}
+	data, err := env.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		ok   bool
+	}{
+		{"round trip", data, true},
+		{"changed", bytes.Replace(data, []byte(`"level":2`), []byte(`"level":3`), 1), false},
+		{"stripped", bytes.Replace(data, []byte(`,"priority":{"level":2}`), nil, 1), false},
+		{"added", bytes.Replace(data, []byte(`{"level":2}`), []byte(`{"level":2},"urgent":true`), 1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if bytes.Equal(tt.data, data) != tt.ok {
+				t.Fatalf("test data wasn't edited: %s", tt.data)
+			}
+			got, err := UnmarshalEnvelope(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ok, err := got.Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.ok {
+				t.Errorf("verifies %v, want %v", ok, tt.ok)
+			}
+			again, err := got.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(again, tt.data) {
+				t.Errorf("re-encoded as %s, want %s", again, tt.data)
+			}
+		})
+	}
+}
+
+// TestVerifyVersions checks that v1 envelopes from older peers are still
+// accepted and that versions newer than CurrentVersion are refused.
+func TestVerifyVersions(t *testing.T) {
+	kp, from := testKey(t)
+	tests := []struct {
+		v       int
+		ok      bool
+		wantErr bool
+	}{
+		{V1, true, false},
+		{V2, true, false},
+		{CurrentVersion + 1, false, true},
+	}
+	for _, tt := range tests {
+		env := NewEnvelope(from, from, "message", "hello")
+		env.V = tt.v
+		env.Meta = map[string]string{"task": "7"}
+		if err := env.Sign(kp); err != nil {
+			t.Fatal(err)
+		}
+		data, err := env.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := UnmarshalEnvelope(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ok, err := got.Verify()
+		if ok != tt.ok || (err != nil) != tt.wantErr {
+			t.Errorf("v%d: verifies %v, %v; want %v", tt.v, ok, err, tt.ok)
+		}
+
+		got.Body = "hello!"
+		if ok, _ := got.Verify(); ok {
+			t.Errorf("v%d: tampered body verifies", tt.v)
+		}
+	}
+}
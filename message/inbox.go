@@ -18,25 +18,20 @@ func InboxPath(hollerDir string) string {
 	return filepath.Join(hollerDir, inboxFile)
 }
 
-// AppendToInbox appends a JSON-encoded envelope line to the inbox file.
-func AppendToInbox(hollerDir string, data []byte) error {
-	return appendToFile(filepath.Join(hollerDir, inboxFile), data)
+// SentPath returns the path to ~/.holler/sent.jsonl.
+func SentPath(hollerDir string) string {
+	return filepath.Join(hollerDir, sentFile)
 }
 
-// AppendToSent appends a JSON-encoded envelope line to the sent log.
-func AppendToSent(hollerDir string, data []byte) error {
-	return appendToFile(filepath.Join(hollerDir, sentFile), data)
-}
-
-// LoadInbox reads all envelopes from the inbox file.
-func LoadInbox(hollerDir string) ([]*Envelope, error) {
-	path := InboxPath(hollerDir)
+// loadEnvelopes reads a JSONL file of envelopes, skipping corrupt lines.
+// A missing file yields no envelopes.
+func loadEnvelopes(path string) ([]*Envelope, error) {
 	f, err := os.Open(path)
 	if os.IsNotExist(err) {
 		return nil, nil
 	}
 	if err != nil {
-		return nil, fmt.Errorf("open inbox: %w", err)
+		return nil, fmt.Errorf("open %s: %w", filepath.Base(path), err)
 	}
 	defer f.Close()
 
@@ -53,14 +48,53 @@ func LoadInbox(hollerDir string) ([]*Envelope, error) {
 	return envelopes, scanner.Err()
 }
 
-func appendToFile(path string, data []byte) error {
-	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// writeEnvelopes atomically overwrites a JSONL file of envelopes with envs.
+// No envelopes removes the file.
+func writeEnvelopes(path string, envs []*Envelope) error {
+	name := filepath.Base(path)
+	if len(envs) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
 	if err != nil {
-		return fmt.Errorf("open %s: %w", filepath.Base(path), err)
+		return fmt.Errorf("create %s tmp: %w", name, err)
 	}
-	defer f.Close()
-	if _, err := f.Write(append(data, '\n')); err != nil {
-		return fmt.Errorf("write to %s: %w", filepath.Base(path), err)
+	for _, env := range envs {
+		data, err := json.Marshal(env)
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return fmt.Errorf("marshal envelope: %w", err)
+		}
+		if _, err := f.Write(append(data, '\n')); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return fmt.Errorf("write %s: %w", name, err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("close %s tmp: %w", name, err)
 	}
-	return nil
+	return os.Rename(tmp, path)
+}
+
+// appendToFile appends data as one line, holding path's lock so concurrent
+// writers never interleave or land in a file that is being replaced.
+func appendToFile(path string, data []byte) error {
+	return withLock(path, func() error {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("open %s: %w", filepath.Base(path), err)
+		}
+		defer f.Close()
+		if _, err := f.Write(append(data, '\n')); err != nil {
+			return fmt.Errorf("write to %s: %w", filepath.Base(path), err)
+		}
+		return nil
+	})
 }
@@ -0,0 +1,39 @@
+package message
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// lockFile takes an exclusive advisory lock guarding path, blocking until it
+// is free, and returns the function that releases it. The lock is held on a
+// path+".lock" sidecar rather than on path itself, because rewrites replace
+// path with a new file and would orphan a lock held on the old one. flock
+// locks belong to the open file, so this serialises goroutines in one
+// process as well as separate processes.
+func lockFile(path string) (func(), error) {
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open %s lock: %w", filepath.Base(path), err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("lock %s: %w", filepath.Base(path), err)
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// withLock runs fn while holding the lock guarding path.
+func withLock(path string, fn func() error) error {
+	unlock, err := lockFile(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return fn()
+}
@@ -0,0 +1,96 @@
+package message
+
+import (
+	"fmt"
+	"os"
+)
+
+// MigrateCounts reports what MigrateStore copied.
+type MigrateCounts struct {
+	Inbox  int
+	Sent   int
+	Outbox int
+}
+
+// MigrateStore copies the inbox and its state, the sent log and the outbox
+// of the holler directory into the backend named by to, then switches over
+// to it. The old files are kept with a .bak suffix. Nothing else may use
+// the store while it runs.
+func MigrateStore(hollerDir, to string) (MigrateCounts, error) {
+	var counts MigrateCounts
+	if to != BackendJSONL && to != BackendBolt {
+		return counts, fmt.Errorf("unknown store backend %q: must be %s or %s", to, BackendJSONL, BackendBolt)
+	}
+	from, err := OpenStore(hollerDir)
+	if err != nil {
+		return counts, err
+	}
+	if from.Backend() == to {
+		return counts, fmt.Errorf("store is already %s", to)
+	}
+
+	inbox, err := from.Messages(MailboxInbox, Query{})
+	if err != nil {
+		return counts, fmt.Errorf("read inbox: %w", err)
+	}
+	sent, err := from.Messages(MailboxSent, Query{})
+	if err != nil {
+		return counts, fmt.Errorf("read sent: %w", err)
+	}
+	states, err := from.States()
+	if err != nil {
+		return counts, fmt.Errorf("read inbox state: %w", err)
+	}
+	outbox, err := from.Outbox()
+	if err != nil {
+		return counts, fmt.Errorf("read outbox: %w", err)
+	}
+	counts = MigrateCounts{Inbox: len(inbox), Sent: len(sent), Outbox: len(outbox)}
+
+	jsonlFiles := []string{InboxPath(hollerDir), SentPath(hollerDir), OutboxPath(hollerDir), StatePath(hollerDir)}
+	if to == BackendBolt {
+		// Renaming the finished database into place is the switch-over.
+		tmp := BoltPath(hollerDir) + ".tmp"
+		os.Remove(tmp)
+		if err := importBolt(tmp, inbox, sent, states, outbox); err != nil {
+			os.Remove(tmp)
+			return counts, err
+		}
+		if err := os.Rename(tmp, BoltPath(hollerDir)); err != nil {
+			return counts, err
+		}
+		return counts, backUp(jsonlFiles...)
+	}
+
+	for _, path := range jsonlFiles {
+		if _, err := os.Stat(path); err == nil {
+			return counts, fmt.Errorf("%s already exists; move it aside first", path)
+		}
+	}
+	if err := writeEnvelopes(InboxPath(hollerDir), inbox); err != nil {
+		return counts, err
+	}
+	if err := writeEnvelopes(SentPath(hollerDir), sent); err != nil {
+		return counts, err
+	}
+	if err := writeOutbox(hollerDir, outbox); err != nil {
+		return counts, err
+	}
+	if len(states) > 0 {
+		if err := writeStates(StatePath(hollerDir), states); err != nil {
+			return counts, err
+		}
+	}
+	// Moving the database aside is the switch-over.
+	return counts, backUp(BoltPath(hollerDir))
+}
+
+// backUp renames each existing path to path.bak.
+func backUp(paths ...string) error {
+	for _, path := range paths {
+		if err := os.Rename(path, path+".bak"); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("back up %s: %w", path, err)
+		}
+	}
+	return nil
+}
@@ -13,9 +13,11 @@ const outboxFile = "outbox.jsonl"
 
 // OutboxEntry wraps an envelope with retry metadata.
 type OutboxEntry struct {
-	Envelope  *Envelope `json:"envelope"`
-	Attempts  int       `json:"attempts"`
-	NextRetry int64     `json:"next_retry"`
+	Envelope    *Envelope `json:"envelope"`
+	Attempts    int       `json:"attempts"`
+	NextRetry   int64     `json:"next_retry"`
+	LastAttempt int64     `json:"last_attempt,omitempty"`
+	LastError   string    `json:"last_error,omitempty"` // why the last attempt failed
 }
 
 // OutboxPath returns the path to ~/.holler/outbox.jsonl.
@@ -23,31 +25,23 @@ func OutboxPath(hollerDir string) string {
 	return filepath.Join(hollerDir, outboxFile)
 }
 
-// SaveToOutbox appends a new outbox entry for a failed delivery.
-func SaveToOutbox(hollerDir string, env *Envelope) error {
+// NewOutboxEntry makes the outbox entry for a failed delivery, due for its
+// first retry in 30 seconds. lastErr, if not nil, is why the delivery failed.
+func NewOutboxEntry(env *Envelope, lastErr error) OutboxEntry {
 	entry := OutboxEntry{
 		Envelope:  env,
 		Attempts:  0,
 		NextRetry: time.Now().Add(30 * time.Second).Unix(),
 	}
-	data, err := json.Marshal(entry)
-	if err != nil {
-		return fmt.Errorf("marshal outbox entry: %w", err)
-	}
-	path := OutboxPath(hollerDir)
-	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("open outbox: %w", err)
-	}
-	defer f.Close()
-	if _, err := f.Write(append(data, '\n')); err != nil {
-		return fmt.Errorf("write to outbox: %w", err)
+	if lastErr != nil {
+		entry.LastAttempt = time.Now().Unix()
+		entry.LastError = lastErr.Error()
 	}
-	return nil
+	return entry
 }
 
-// LoadOutbox reads all outbox entries from disk.
-func LoadOutbox(hollerDir string) ([]OutboxEntry, error) {
+// loadOutbox reads all entries from outbox.jsonl.
+func loadOutbox(hollerDir string) ([]OutboxEntry, error) {
 	path := OutboxPath(hollerDir)
 	f, err := os.Open(path)
 	if os.IsNotExist(err) {
@@ -71,8 +65,9 @@ func LoadOutbox(hollerDir string) ([]OutboxEntry, error) {
 	return entries, scanner.Err()
 }
 
-// WriteOutbox atomically overwrites the outbox file with the given entries.
-func WriteOutbox(hollerDir string, entries []OutboxEntry) error {
+// writeOutbox atomically overwrites the outbox file with the given entries.
+// Callers must hold the outbox lock.
+func writeOutbox(hollerDir string, entries []OutboxEntry) error {
 	path := OutboxPath(hollerDir)
 	if len(entries) == 0 {
 		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
@@ -0,0 +1,74 @@
+package message
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"math/bits"
+	"strconv"
+)
+
+// MaxPoWBits is the highest difficulty a sender will agree to mint.
+// Each extra bit doubles the work; 28 bits is already minutes of CPU.
+const MaxPoWBits = 28
+
+const powDomain = "holler-pow\x00"
+
+// powCheckEvery is how many hashes MintPoW tries between checks for
+// cancellation.
+const powCheckEvery = 1 << 16
+
+// PoWBits returns the number of leading zero bits of the envelope's
+// proof-of-work hash, or 0 if it carries no stamp.
+func (e *Envelope) PoWBits() int {
+	if e.PoW == "" {
+		return 0
+	}
+	sum := powHash(e.signPayload(), e.PoW)
+	return leadingZeroBits(sum[:])
+}
+
+// MintPoW searches for a stamp with at least difficulty leading zero bits and
+// stores it in e.PoW. The stamp covers the signed payload, so it must be
+// minted after every signed field is final; the signature stays valid.
+// It gives up with ctx's error once ctx is done.
+func (e *Envelope) MintPoW(ctx context.Context, difficulty int) error {
+	if difficulty <= 0 {
+		return nil
+	}
+	payload := e.signPayload()
+	for n := uint64(0); ; n++ {
+		if n%powCheckEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("mint proof-of-work: %w", err)
+			}
+		}
+		nonce := strconv.FormatUint(n, 36)
+		sum := powHash(payload, nonce)
+		if leadingZeroBits(sum[:]) >= difficulty {
+			e.PoW = nonce
+			return nil
+		}
+	}
+}
+
+func powHash(payload []byte, nonce string) [32]byte {
+	h := sha256.New()
+	h.Write([]byte(powDomain))
+	h.Write(payload)
+	h.Write([]byte(nonce))
+	var sum [32]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, c := range b {
+		if c != 0 {
+			return n + bits.LeadingZeros8(c)
+		}
+		n += 8
+	}
+	return n
+}
@@ -0,0 +1,53 @@
+package message
+
+import "path/filepath"
+
+const receiptsFile = "receipts.jsonl"
+
+// Receipt types. A receipt's body (and reply_to) is the ID of the message it
+// acknowledges. "received" is the synchronous reply of a peer that negotiated
+// receipts; "processed" and "read" arrive later as envelopes of their own.
+const (
+	ReceiptReceived  = "received"  // stored durably by the recipient
+	ReceiptProcessed = "processed" // the recipient's hook or agent finished with it
+	ReceiptRead      = "read"      // a human or agent marked it read
+)
+
+// IsReceipt reports whether msgType is a delivery receipt.
+func IsReceipt(msgType string) bool {
+	return msgType == ReceiptReceived || msgType == ReceiptProcessed || msgType == ReceiptRead
+}
+
+// WantsReceipts reports whether a message of msgType should be answered with
+// processed and read receipts. Control traffic never is, so receipts can't loop.
+func WantsReceipts(msgType string) bool {
+	switch msgType {
+	case "ack", "nack", "ping":
+		return false
+	}
+	return !IsReceipt(msgType)
+}
+
+// NewReceipt creates an unsigned receipt of receiptType for orig, addressed
+// back to its sender.
+func NewReceipt(fromOnion string, receiptType string, orig *Envelope) *Envelope {
+	env := NewEnvelope(fromOnion, orig.From, receiptType, orig.ID)
+	env.ReplyTo = orig.ID
+	env.ThreadID = orig.ThreadID
+	return env
+}
+
+// ReceiptsPath returns the path to ~/.holler/receipts.jsonl.
+func ReceiptsPath(hollerDir string) string {
+	return filepath.Join(hollerDir, receiptsFile)
+}
+
+// AppendToReceipts appends a JSON-encoded receipt envelope to receipts.jsonl.
+func AppendToReceipts(hollerDir string, data []byte) error {
+	return appendToFile(ReceiptsPath(hollerDir), data)
+}
+
+// LoadReceipts reads all receipts we have been sent.
+func LoadReceipts(hollerDir string) ([]*Envelope, error) {
+	return loadEnvelopes(ReceiptsPath(hollerDir))
+}
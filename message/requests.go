@@ -0,0 +1,46 @@
+package message
+
+import (
+	"path/filepath"
+)
+
+const requestsFile = "requests.jsonl"
+
+// RequestsPath returns the path to ~/.holler/requests.jsonl, the quarantine
+// queue for messages from senders who are not in contacts.
+func RequestsPath(hollerDir string) string {
+	return filepath.Join(hollerDir, requestsFile)
+}
+
+// AppendToRequests appends a JSON-encoded envelope line to the quarantine queue.
+func AppendToRequests(hollerDir string, data []byte) error {
+	return appendToFile(RequestsPath(hollerDir), data)
+}
+
+// LoadRequests reads all quarantined envelopes.
+func LoadRequests(hollerDir string) ([]*Envelope, error) {
+	return loadEnvelopes(RequestsPath(hollerDir))
+}
+
+// UpdateRequests replaces the quarantine queue with what fn returns for its
+// current envelopes, holding the queue's lock so messages quarantined
+// meanwhile aren't lost. fn must not call other requests functions. An error
+// from fn leaves the queue unchanged.
+func UpdateRequests(hollerDir string, fn func([]*Envelope) ([]*Envelope, error)) error {
+	return withLock(RequestsPath(hollerDir), func() error {
+		envs, err := LoadRequests(hollerDir)
+		if err != nil {
+			return err
+		}
+		if envs, err = fn(envs); err != nil {
+			return err
+		}
+		return writeRequests(hollerDir, envs)
+	})
+}
+
+// writeRequests atomically overwrites the quarantine queue with envs.
+// Callers must hold the queue's lock.
+func writeRequests(hollerDir string, envs []*Envelope) error {
+	return writeEnvelopes(RequestsPath(hollerDir), envs)
+}
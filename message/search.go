@@ -0,0 +1,130 @@
+package message
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// BM25 parameters: how quickly repeated terms stop adding to the score, and
+// how much long bodies are penalised.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// phraseBoost is added to the score of a body containing the whole query.
+const phraseBoost = 1.0
+
+// SearchHit is a message matching a full-text search.
+type SearchHit struct {
+	Mailbox  Mailbox
+	Envelope *Envelope
+	Score    float64
+}
+
+// Search returns the messages in boxes selected by q whose body contains
+// any term of text, best match first. Terms are case-insensitive words;
+// bodies are ranked by BM25 over the selected messages, with a bonus for
+// containing the query as a phrase, and ties go to the newer message.
+// q.Last, if set, caps the number of hits.
+func Search(st Store, boxes []Mailbox, text string, q Query) ([]SearchHit, error) {
+	terms := uniqueTerms(Terms(text))
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	limit := q.Last
+	q.Last = 0
+
+	type doc struct {
+		box   Mailbox
+		env   *Envelope
+		freq  map[string]int
+		words []string
+	}
+	// Document frequencies and lengths count every selected message, not
+	// only the matching ones, so common words weigh less.
+	var docs []doc
+	df := make(map[string]int, len(terms))
+	total, totalWords := 0, 0
+	for _, box := range boxes {
+		envs, err := st.Messages(box, q)
+		if err != nil {
+			return nil, err
+		}
+		for _, env := range envs {
+			words := Terms(env.Body)
+			freq := make(map[string]int)
+			for _, w := range words {
+				freq[w]++
+			}
+			matched := false
+			for _, t := range terms {
+				if freq[t] > 0 {
+					df[t]++
+					matched = true
+				}
+			}
+			total++
+			totalWords += len(words)
+			if matched {
+				docs = append(docs, doc{box: box, env: env, freq: freq, words: words})
+			}
+		}
+	}
+	if len(docs) == 0 {
+		return nil, nil
+	}
+
+	n := float64(total)
+	avgWords := float64(totalWords) / n
+	phrase := " " + strings.Join(Terms(text), " ") + " "
+
+	hits := make([]SearchHit, len(docs))
+	for i, d := range docs {
+		var score float64
+		for _, t := range terms {
+			tf := float64(d.freq[t])
+			if tf == 0 {
+				continue
+			}
+			idf := math.Log(1 + (n-float64(df[t])+0.5)/(float64(df[t])+0.5))
+			norm := 1 - bm25B + bm25B*float64(len(d.words))/avgWords
+			score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+		if len(terms) > 1 && strings.Contains(" "+strings.Join(d.words, " ")+" ", phrase) {
+			score += phraseBoost
+		}
+		hits[i] = SearchHit{Mailbox: d.box, Envelope: d.env, Score: score}
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Envelope.Ts > hits[j].Envelope.Ts
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+// Terms splits text into lower-case words of letters and digits.
+func Terms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func uniqueTerms(terms []string) []string {
+	seen := make(map[string]bool, len(terms))
+	var out []string
+	for _, t := range terms {
+		if !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
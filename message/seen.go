@@ -0,0 +1,240 @@
+package message
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const seenFile = "seen.jsonl"
+
+// DefaultSeenCacheSize is the default number of envelopes the seen store
+// holds at once.
+const DefaultSeenCacheSize = 50000
+
+// ErrSeenFull is returned by Mark when the seen store holds as many
+// envelopes as it may. The envelope should be refused for now: forgetting a
+// live entry to make room would let that envelope be replayed.
+var ErrSeenFull = errors.New("seen store full")
+
+const (
+	// seenPruneInterval is how often expired entries are dropped.
+	seenPruneInterval = time.Minute
+	// seenCompactSlack is how many dead lines the file may hold beyond the
+	// live set before it is rewritten.
+	seenCompactSlack = 1024
+)
+
+// seenRecord is one line of seen.jsonl.
+type seenRecord struct {
+	From   string `json:"from"`
+	ID     string `json:"id"`
+	Ts     int64  `json:"ts"`
+	Forget bool   `json:"forget,omitempty"` // tombstone written by Forget
+}
+
+// seenKey identifies an envelope: IDs are chosen by senders, so only the
+// pair is unique.
+type seenKey struct {
+	from, id string
+}
+
+// SeenStore remembers the envelopes received within the acceptance window
+// so replays can be detected. It is backed by seen.jsonl in the holler
+// directory. Entries are kept until their ts falls outside maxAge, after
+// which the receive path rejects the envelope as too old anyway, so nothing
+// can be replayed by pushing entries out. The store holds at most size
+// entries; once full, Mark refuses new ones until old ones expire. Safe for
+// concurrent use.
+type SeenStore struct {
+	mu     sync.Mutex
+	path   string
+	maxAge time.Duration
+	size   int
+	ids    map[seenKey]int64
+	lines  int       // lines in the file, including pruned ones
+	pruned time.Time // last prune
+}
+
+// SeenPath returns the path to ~/.holler/seen.jsonl.
+func SeenPath(hollerDir string) string {
+	return filepath.Join(hollerDir, seenFile)
+}
+
+// OpenSeenStore loads the seen store from disk, dropping entries older than
+// maxAge. It holds at most size entries. A missing file yields an empty
+// store.
+func OpenSeenStore(hollerDir string, maxAge time.Duration, size int) (*SeenStore, error) {
+	if size <= 0 {
+		size = DefaultSeenCacheSize
+	}
+	s := &SeenStore{
+		path:   SeenPath(hollerDir),
+		maxAge: maxAge,
+		size:   size,
+		ids:    make(map[seenKey]int64),
+	}
+
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open seen store: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		s.lines++
+		var rec seenRecord
+		// Skip corrupt lines, and entries from before the sender was
+		// recorded: they can't be told apart from other senders' IDs.
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil || rec.ID == "" || rec.From == "" {
+			continue
+		}
+		key := seenKey{rec.From, rec.ID}
+		if rec.Forget {
+			delete(s.ids, key)
+		} else {
+			s.ids[key] = rec.Ts
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read seen store: %w", err)
+	}
+	s.prune(time.Now())
+	return s, nil
+}
+
+// Mark records the envelope id from sender from as seen. It returns false
+// without writing anything if it was already present, which makes
+// check-and-record atomic across concurrent connections. If the store is
+// full it records nothing and returns ErrSeenFull.
+func (s *SeenStore) Mark(from, id string, ts int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := seenKey{from, id}
+	if _, ok := s.ids[key]; ok {
+		return false, nil
+	}
+	if now := time.Now(); now.Sub(s.pruned) >= seenPruneInterval || len(s.ids) >= s.size {
+		s.prune(now)
+	}
+	if len(s.ids) >= s.size {
+		return false, ErrSeenFull
+	}
+	s.ids[key] = ts
+
+	// Compact once dead lines outnumber live ones, so the file stays bounded.
+	if s.lines+1 > 2*len(s.ids)+seenCompactSlack {
+		return true, s.compact()
+	}
+	if err := s.append(seenRecord{From: from, ID: id, Ts: ts}); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// Forget removes the entry so the same envelope is accepted again, for when
+// it was marked but could not be stored. The removal is persisted as a
+// tombstone.
+func (s *SeenStore) Forget(from, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := seenKey{from, id}
+	if _, ok := s.ids[key]; !ok {
+		return nil
+	}
+	delete(s.ids, key)
+	return s.append(seenRecord{From: from, ID: id, Forget: true})
+}
+
+// Len returns the number of entries currently remembered.
+func (s *SeenStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.ids)
+}
+
+// prune drops entries whose ts is older than maxAge. Callers must hold s.mu
+// (or own s exclusively).
+func (s *SeenStore) prune(now time.Time) {
+	s.pruned = now
+	if s.maxAge <= 0 {
+		return
+	}
+	cutoff := now.Add(-s.maxAge).Unix()
+	for key, ts := range s.ids {
+		if ts < cutoff {
+			delete(s.ids, key)
+		}
+	}
+}
+
+// append writes one record to the file. Callers must hold s.mu.
+func (s *SeenStore) append(rec seenRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("marshal seen record: %w", err)
+	}
+	if err := appendToFile(s.path, data); err != nil {
+		return err
+	}
+	s.lines++
+	return nil
+}
+
+// compact atomically rewrites the file with only the live entries, oldest
+// first. Callers must hold s.mu.
+func (s *SeenStore) compact() error {
+	unlock, err := lockFile(s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	keys := make([]seenKey, 0, len(s.ids))
+	for key := range s.ids {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return s.ids[keys[i]] < s.ids[keys[j]] })
+
+	tmp := s.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("create seen tmp: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	for _, key := range keys {
+		data, err := json.Marshal(seenRecord{From: key.from, ID: key.id, Ts: s.ids[key]})
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return fmt.Errorf("marshal seen record: %w", err)
+		}
+		w.Write(append(data, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("write seen tmp: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("close seen tmp: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.lines = len(keys)
+	return nil
+}
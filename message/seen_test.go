@@ -0,0 +1,85 @@
+package message
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestSeenStoreReplayAcrossRestart checks that an envelope marked before a
+// restart is still a replay after it, and that entries are per sender.
+func TestSeenStoreReplayAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().Unix()
+	s, err := OpenSeenStore(dir, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if fresh, err := s.Mark("alice", id, now); err != nil || !fresh {
+			t.Fatalf("mark %s: fresh %v, %v", id, fresh, err)
+		}
+	}
+	if err := s.Forget("alice", "c"); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = OpenSeenStore(dir, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		from, id string
+		fresh    bool
+	}{
+		{"alice", "a", false},
+		{"alice", "b", false},
+		{"alice", "c", true}, // forgotten before the restart
+		{"bob", "a", true},   // another sender's ID
+	}
+	for _, tt := range tests {
+		fresh, err := s.Mark(tt.from, tt.id, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fresh != tt.fresh {
+			t.Errorf("%s/%s after restart: fresh %v, want %v", tt.from, tt.id, fresh, tt.fresh)
+		}
+	}
+}
+
+// TestSeenStoreFull checks that a full store refuses new envelopes instead
+// of forgetting old ones, and makes room only as entries expire.
+func TestSeenStoreFull(t *testing.T) {
+	const size = 3
+	maxAge := time.Hour
+	now := time.Now()
+	s, err := OpenSeenStore(t.TempDir(), maxAge, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := now.Add(-maxAge + 2*time.Second).Unix() // about to expire
+	if _, err := s.Mark("alice", "old", old); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b"} {
+		if _, err := s.Mark("alice", id, now.Unix()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := s.Mark("mallory", "flood", now.Unix()); !errors.Is(err, ErrSeenFull) {
+		t.Fatalf("mark when full: %v, want ErrSeenFull", err)
+	}
+	if fresh, err := s.Mark("alice", "old", old); err != nil || fresh {
+		t.Fatalf("replay when full: fresh %v, %v; want a duplicate", fresh, err)
+	}
+	if s.Len() != size {
+		t.Fatalf("len %d, want %d", s.Len(), size)
+	}
+
+	time.Sleep(3 * time.Second)
+	if fresh, err := s.Mark("bob", "later", time.Now().Unix()); err != nil || !fresh {
+		t.Fatalf("mark after expiry: fresh %v, %v", fresh, err)
+	}
+}
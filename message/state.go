@@ -0,0 +1,120 @@
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const stateFile = "inbox_state.json"
+
+// MessageState is the local state of an inbox message. Messages without a
+// stored state are unread, not archived and unlabelled.
+type MessageState struct {
+	Read     bool     `json:"read"`
+	Archived bool     `json:"archived"`
+	Labels   []string `json:"labels,omitempty"`
+}
+
+// IsZero reports whether s is the default state, which isn't stored.
+func (s MessageState) IsZero() bool {
+	return !s.Read && !s.Archived && len(s.Labels) == 0
+}
+
+// HasLabel reports whether s carries label.
+func (s MessageState) HasLabel(label string) bool {
+	for _, l := range s.Labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// AddLabel adds label, keeping labels sorted. Returns false if already present.
+func (s *MessageState) AddLabel(label string) bool {
+	if s.HasLabel(label) {
+		return false
+	}
+	s.Labels = append(s.Labels, label)
+	sort.Strings(s.Labels)
+	return true
+}
+
+// RemoveLabel removes label. Returns false if it wasn't present.
+func (s *MessageState) RemoveLabel(label string) bool {
+	for i, l := range s.Labels {
+		if l == label {
+			s.Labels = append(s.Labels[:i], s.Labels[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// StatePath returns the path to ~/.holler/inbox_state.json, the JSONL
+// store's map of state key to state.
+func StatePath(hollerDir string) string {
+	return filepath.Join(hollerDir, stateFile)
+}
+
+// StateKey returns the key env's state is stored under, its Key.
+func StateKey(env *Envelope) string {
+	return env.Key()
+}
+
+// StateOf returns env's state in states, as returned by Store.States. A
+// state saved before states were keyed by sender is found by its ID.
+func StateOf(states map[string]MessageState, env *Envelope) MessageState {
+	if s, ok := states[StateKey(env)]; ok {
+		return s
+	}
+	return states[env.ID]
+}
+
+// applyState runs fn on the state of each of envs in states, dropping states
+// that end up at the default. A state found by ID alone is moved to the
+// envelope's key.
+func applyState(states map[string]MessageState, envs []*Envelope, fn func(*MessageState)) {
+	for _, env := range envs {
+		s := StateOf(states, env)
+		delete(states, env.ID)
+		fn(&s)
+		if s.IsZero() {
+			delete(states, StateKey(env))
+		} else {
+			states[StateKey(env)] = s
+		}
+	}
+}
+
+// loadStates reads a state file. A missing file yields no states.
+func loadStates(path string) (map[string]MessageState, error) {
+	states := make(map[string]MessageState)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read inbox state: %w", err)
+	}
+	if err := json.Unmarshal(data, &states); err != nil {
+		return nil, fmt.Errorf("parse inbox state: %w", err)
+	}
+	return states, nil
+}
+
+// writeStates atomically overwrites a state file. Callers must hold its lock.
+func writeStates(path string, states map[string]MessageState) error {
+	data, err := json.Marshal(states)
+	if err != nil {
+		return fmt.Errorf("marshal inbox state: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write inbox state: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,145 @@
+package message
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Mailbox names one of the envelope logs kept by a Store.
+type Mailbox string
+
+const (
+	MailboxInbox Mailbox = "inbox" // messages received
+	MailboxSent  Mailbox = "sent"  // messages delivered
+)
+
+// Storage backends.
+const (
+	BackendJSONL = "jsonl" // inbox.jsonl, sent.jsonl and outbox.jsonl (default)
+	BackendBolt  = "bolt"  // indexed holler.db
+)
+
+// Store keeps the inbox with its per-message state, the sent log and the
+// outbox. Implementations are safe for concurrent use by several goroutines
+// and processes.
+type Store interface {
+	// Backend returns BackendJSONL or BackendBolt.
+	Backend() string
+	// Append adds env to the end of box.
+	Append(box Mailbox, env *Envelope) error
+	// Messages returns the envelopes in box matching q, oldest first.
+	Messages(box Mailbox, q Query) ([]*Envelope, error)
+	// Outbox returns the pending outbox entries, oldest first.
+	Outbox() ([]OutboxEntry, error)
+	// Enqueue adds entry to the end of the outbox.
+	Enqueue(entry OutboxEntry) error
+	// UpdateOutbox replaces the outbox with what fn returns for its current
+	// entries, with no other writer in between. fn must not use the Store.
+	// An error from fn leaves the outbox unchanged.
+	UpdateOutbox(fn func([]OutboxEntry) ([]OutboxEntry, error)) error
+	// States returns the state of every inbox message that has one, by
+	// StateKey. Use StateOf to look up a message.
+	States() (map[string]MessageState, error)
+	// UpdateStates applies fn to the state of each inbox message in envs,
+	// with no other writer in between. fn must not use the Store.
+	UpdateStates(envs []*Envelope, fn func(*MessageState)) error
+}
+
+// Query selects envelopes from a mailbox. Zero fields match everything.
+// The state filters only mean something for the inbox.
+type Query struct {
+	ID       string // full message ID or ID prefix
+	Peer     string // the sender in the inbox, the recipient in the sent log
+	ThreadID string
+	ReplyTo  string
+	Type     string
+	Meta     map[string]string // every pair must be present in the envelope's meta
+	Since    int64             // earliest timestamp, inclusive (unix seconds)
+	Until    int64             // latest timestamp, exclusive (unix seconds)
+	Last     int               // keep only the newest Last matches
+
+	Unread       bool   // only messages not marked read
+	SkipArchived bool   // leave out archived messages
+	Label        string // only messages carrying this label
+}
+
+// needsState reports whether q filters on message state.
+func (q Query) needsState() bool {
+	return q.Unread || q.SkipArchived || q.Label != ""
+}
+
+// Match reports whether env, filed in box with the given state, is
+// selected by q. Last is not considered.
+func (q Query) Match(box Mailbox, env *Envelope, state MessageState) bool {
+	switch {
+	case q.Unread && state.Read:
+		return false
+	case q.SkipArchived && state.Archived:
+		return false
+	case q.Label != "" && !state.HasLabel(q.Label):
+		return false
+	case q.ID != "" && !strings.HasPrefix(env.ID, q.ID):
+		return false
+	case q.Peer != "" && peerOf(box, env) != q.Peer:
+		return false
+	case q.ThreadID != "" && env.ThreadID != q.ThreadID:
+		return false
+	case q.ReplyTo != "" && env.ReplyTo != q.ReplyTo:
+		return false
+	case q.Type != "" && env.Type != q.Type:
+		return false
+	case q.Since != 0 && env.Ts < q.Since:
+		return false
+	case q.Until != 0 && env.Ts >= q.Until:
+		return false
+	}
+	for k, v := range q.Meta {
+		if got, ok := env.Meta[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// limit applies q.Last to matches, which are oldest first.
+func (q Query) limit(matches []*Envelope) []*Envelope {
+	if q.Last > 0 && len(matches) > q.Last {
+		return matches[len(matches)-q.Last:]
+	}
+	return matches
+}
+
+// peerOf returns the other party of env as filed in box.
+func peerOf(box Mailbox, env *Envelope) string {
+	if box == MailboxSent {
+		return env.To
+	}
+	return env.From
+}
+
+// OpenStore returns the store for the holler directory: the database once
+// `holler migrate-store` has created holler.db, the JSONL files otherwise.
+func OpenStore(hollerDir string) (Store, error) {
+	backend, err := StoreBackend(hollerDir)
+	if err != nil {
+		return nil, err
+	}
+	if backend == BackendBolt {
+		return NewBoltStore(hollerDir), nil
+	}
+	return NewJSONLStore(hollerDir), nil
+}
+
+// StoreBackend reports which backend the holler directory uses.
+func StoreBackend(hollerDir string) (string, error) {
+	_, err := os.Stat(BoltPath(hollerDir))
+	switch {
+	case err == nil:
+		return BackendBolt, nil
+	case os.IsNotExist(err):
+		return BackendJSONL, nil
+	default:
+		return "", fmt.Errorf("check store: %w", err)
+	}
+}
@@ -0,0 +1,439 @@
+package message
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const boltFile = "holler.db"
+
+// boltTimeout bounds the wait for another process to release the database.
+const boltTimeout = 10 * time.Second
+
+// Bucket layout. Each mailbox is a top-level bucket holding the envelopes
+// keyed by arrival sequence, plus one index bucket per queryable field whose
+// keys are the field value, a zero byte and the sequence (the time index is
+// the big-endian timestamp followed by the sequence). Inbox message state is
+// kept in its own bucket keyed by message ID.
+var (
+	bucketOutbox = []byte("outbox")
+	bucketState  = []byte("inbox_state")
+	bucketMsgs   = []byte("msgs")
+	indexID      = []byte("id")
+	indexPeer    = []byte("peer")
+	indexThread  = []byte("thread")
+	indexType    = []byte("type")
+	indexTime    = []byte("time")
+)
+
+// boltStore is the Store kept in holler.db, an embedded bbolt database. The
+// database is opened for each operation rather than held, since bbolt locks
+// the file against every other process while it is open.
+type boltStore struct {
+	path string
+}
+
+// BoltPath returns the path to ~/.holler/holler.db.
+func BoltPath(hollerDir string) string {
+	return filepath.Join(hollerDir, boltFile)
+}
+
+// NewBoltStore returns the database store for the holler directory. The
+// database is created on first write.
+func NewBoltStore(hollerDir string) Store {
+	return &boltStore{path: BoltPath(hollerDir)}
+}
+
+func (s *boltStore) Backend() string {
+	return BackendBolt
+}
+
+func (s *boltStore) view(fn func(tx *bolt.Tx) error) error {
+	db, err := bolt.Open(s.path, 0600, &bolt.Options{Timeout: boltTimeout, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("open %s: %w", boltFile, err)
+	}
+	defer db.Close()
+	return db.View(fn)
+}
+
+func (s *boltStore) update(fn func(tx *bolt.Tx) error) error {
+	db, err := bolt.Open(s.path, 0600, &bolt.Options{Timeout: boltTimeout})
+	if err != nil {
+		return fmt.Errorf("open %s: %w", boltFile, err)
+	}
+	defer db.Close()
+	return db.Update(fn)
+}
+
+func (s *boltStore) Append(box Mailbox, env *Envelope) error {
+	return s.update(func(tx *bolt.Tx) error {
+		return appendMailbox(tx, box, env)
+	})
+}
+
+// appendMailbox stores env at the end of box and indexes it.
+func appendMailbox(tx *bolt.Tx, box Mailbox, env *Envelope) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(box))
+	if err != nil {
+		return fmt.Errorf("create %s bucket: %w", box, err)
+	}
+	data, err := json.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("marshal envelope: %w", err)
+	}
+	n, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	seq := u64(n)
+
+	if err := putKey(b, bucketMsgs, seq, data); err != nil {
+		return err
+	}
+	index := [][2][]byte{
+		{indexID, indexKey(env.ID, seq)},
+		{indexPeer, indexKey(peerOf(box, env), seq)},
+		{indexType, indexKey(env.Type, seq)},
+		{indexTime, append(u64(uint64(env.Ts)), seq...)},
+	}
+	if env.ThreadID != "" {
+		index = append(index, [2][]byte{indexThread, indexKey(env.ThreadID, seq)})
+	}
+	for _, e := range index {
+		if err := putKey(b, e[0], e[1], nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putKey writes key in the named sub-bucket of b, creating it if needed.
+func putKey(b *bolt.Bucket, name, key, value []byte) error {
+	sub, err := b.CreateBucketIfNotExists(name)
+	if err != nil {
+		return fmt.Errorf("create %s bucket: %w", name, err)
+	}
+	if err := sub.Put(key, value); err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+	return nil
+}
+
+// Messages answers q from the most selective index it can use, then checks
+// the remaining fields against each candidate, newest first so that q.Last
+// can stop the scan early.
+func (s *boltStore) Messages(box Mailbox, q Query) ([]*Envelope, error) {
+	var matches []*Envelope
+	err := s.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(box))
+		if b == nil {
+			return nil
+		}
+		msgs := b.Bucket(bucketMsgs)
+		if msgs == nil {
+			return nil
+		}
+
+		var states *bolt.Bucket
+		if box == MailboxInbox && q.needsState() {
+			states = tx.Bucket(bucketState)
+		}
+
+		// visit checks one stored envelope and reports whether to stop.
+		visit := func(data []byte) bool {
+			var env Envelope
+			if data == nil || json.Unmarshal(data, &env) != nil {
+				return false
+			}
+			var state MessageState
+			if states != nil {
+				v := states.Get([]byte(StateKey(&env)))
+				if v == nil {
+					v = states.Get([]byte(env.ID)) // saved before states were keyed by sender
+				}
+				if v != nil {
+					json.Unmarshal(v, &state)
+				}
+			}
+			if !q.Match(box, &env, state) {
+				return false
+			}
+			matches = append(matches, &env)
+			return q.Last > 0 && len(matches) >= q.Last
+		}
+
+		seqs, indexed := candidates(b, q)
+		if indexed {
+			sort.Slice(seqs, func(i, j int) bool { return seqs[i] > seqs[j] })
+			for _, seq := range seqs {
+				if visit(msgs.Get(u64(seq))) {
+					break
+				}
+			}
+			return nil
+		}
+		c := msgs.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			if visit(v) {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Collected newest first; callers get them oldest first.
+	for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+		matches[i], matches[j] = matches[j], matches[i]
+	}
+	return matches, nil
+}
+
+// candidates returns the sequences of the envelopes in b that an index says
+// may match q, or false if q has no indexed field.
+func candidates(b *bolt.Bucket, q Query) ([]uint64, bool) {
+	switch {
+	case q.ID != "":
+		// No separator: the query may be an ID prefix.
+		return scanPrefix(b.Bucket(indexID), []byte(q.ID)), true
+	case q.Peer != "":
+		return scanPrefix(b.Bucket(indexPeer), indexKey(q.Peer, nil)), true
+	case q.ThreadID != "":
+		return scanPrefix(b.Bucket(indexThread), indexKey(q.ThreadID, nil)), true
+	case q.Type != "":
+		return scanPrefix(b.Bucket(indexType), indexKey(q.Type, nil)), true
+	case q.Since != 0 || q.Until != 0:
+		return scanTime(b.Bucket(indexTime), q.Since, q.Until), true
+	}
+	return nil, false
+}
+
+// scanPrefix returns the sequences of the index keys starting with prefix.
+func scanPrefix(idx *bolt.Bucket, prefix []byte) []uint64 {
+	if idx == nil {
+		return nil
+	}
+	var seqs []uint64
+	c := idx.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		seqs = append(seqs, binary.BigEndian.Uint64(k[len(k)-8:]))
+	}
+	return seqs
+}
+
+// scanTime returns the sequences of envelopes timestamped in [since, until).
+// A zero until is open-ended.
+func scanTime(idx *bolt.Bucket, since, until int64) []uint64 {
+	if idx == nil {
+		return nil
+	}
+	var seqs []uint64
+	c := idx.Cursor()
+	for k, _ := c.Seek(u64(uint64(since))); k != nil; k, _ = c.Next() {
+		if until != 0 && int64(binary.BigEndian.Uint64(k[:8])) >= until {
+			break
+		}
+		seqs = append(seqs, binary.BigEndian.Uint64(k[8:]))
+	}
+	return seqs
+}
+
+func (s *boltStore) Outbox() ([]OutboxEntry, error) {
+	var entries []OutboxEntry
+	err := s.view(func(tx *bolt.Tx) error {
+		var err error
+		entries, err = readOutbox(tx)
+		return err
+	})
+	return entries, err
+}
+
+func (s *boltStore) Enqueue(entry OutboxEntry) error {
+	return s.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketOutbox)
+		if err != nil {
+			return fmt.Errorf("create outbox bucket: %w", err)
+		}
+		return putOutboxEntry(b, entry)
+	})
+}
+
+// UpdateOutbox runs fn inside a single write transaction, which excludes
+// every other writer.
+func (s *boltStore) UpdateOutbox(fn func([]OutboxEntry) ([]OutboxEntry, error)) error {
+	return s.update(func(tx *bolt.Tx) error {
+		entries, err := readOutbox(tx)
+		if err != nil {
+			return err
+		}
+		if entries, err = fn(entries); err != nil {
+			return err
+		}
+		return writeOutboxBucket(tx, entries)
+	})
+}
+
+// readOutbox returns the outbox entries in queue order, skipping corrupt ones.
+func readOutbox(tx *bolt.Tx) ([]OutboxEntry, error) {
+	b := tx.Bucket(bucketOutbox)
+	if b == nil {
+		return nil, nil
+	}
+	var entries []OutboxEntry
+	err := b.ForEach(func(_, v []byte) error {
+		var entry OutboxEntry
+		if json.Unmarshal(v, &entry) == nil && entry.Envelope != nil {
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// writeOutboxBucket replaces the outbox bucket with entries.
+func writeOutboxBucket(tx *bolt.Tx, entries []OutboxEntry) error {
+	if tx.Bucket(bucketOutbox) != nil {
+		if err := tx.DeleteBucket(bucketOutbox); err != nil {
+			return fmt.Errorf("clear outbox bucket: %w", err)
+		}
+	}
+	b, err := tx.CreateBucket(bucketOutbox)
+	if err != nil {
+		return fmt.Errorf("create outbox bucket: %w", err)
+	}
+	for _, entry := range entries {
+		if err := putOutboxEntry(b, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func putOutboxEntry(b *bolt.Bucket, entry OutboxEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshal outbox entry: %w", err)
+	}
+	n, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	return b.Put(u64(n), data)
+}
+
+func (s *boltStore) States() (map[string]MessageState, error) {
+	states := make(map[string]MessageState)
+	err := s.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketState)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var state MessageState
+			if json.Unmarshal(v, &state) == nil {
+				states[string(k)] = state
+			}
+			return nil
+		})
+	})
+	return states, err
+}
+
+func (s *boltStore) UpdateStates(envs []*Envelope, fn func(*MessageState)) error {
+	return s.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketState)
+		if err != nil {
+			return fmt.Errorf("create inbox_state bucket: %w", err)
+		}
+		// Load the states applyState may read or move, by key and by ID.
+		states := make(map[string]MessageState, len(envs))
+		var keys []string
+		for _, env := range envs {
+			keys = append(keys, StateKey(env), env.ID)
+		}
+		for _, key := range keys {
+			var state MessageState
+			if v := b.Get([]byte(key)); v != nil && json.Unmarshal(v, &state) == nil {
+				states[key] = state
+			}
+		}
+		applyState(states, envs, fn)
+		for _, key := range keys {
+			state, ok := states[key]
+			if !ok {
+				if err := b.Delete([]byte(key)); err != nil {
+					return fmt.Errorf("write inbox state: %w", err)
+				}
+				continue
+			}
+			if err := putState(b, key, state); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func putState(b *bolt.Bucket, id string, state MessageState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("marshal inbox state: %w", err)
+	}
+	if err := b.Put([]byte(id), data); err != nil {
+		return fmt.Errorf("write inbox state: %w", err)
+	}
+	return nil
+}
+
+// importBolt creates a database at path holding the given messages, inbox
+// state and outbox entries, in one transaction.
+func importBolt(path string, inbox, sent []*Envelope, states map[string]MessageState, outbox []OutboxEntry) error {
+	s := &boltStore{path: path}
+	return s.update(func(tx *bolt.Tx) error {
+		for _, env := range inbox {
+			if err := appendMailbox(tx, MailboxInbox, env); err != nil {
+				return err
+			}
+		}
+		for _, env := range sent {
+			if err := appendMailbox(tx, MailboxSent, env); err != nil {
+				return err
+			}
+		}
+		if len(states) > 0 {
+			b, err := tx.CreateBucket(bucketState)
+			if err != nil {
+				return fmt.Errorf("create inbox_state bucket: %w", err)
+			}
+			for id, state := range states {
+				if err := putState(b, id, state); err != nil {
+					return err
+				}
+			}
+		}
+		return writeOutboxBucket(tx, outbox)
+	})
+}
+
+// indexKey returns value, a zero separator and seq.
+func indexKey(value string, seq []byte) []byte {
+	key := make([]byte, 0, len(value)+1+len(seq))
+	key = append(key, value...)
+	key = append(key, 0)
+	return append(key, seq...)
+}
+
+func u64(n uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, n)
+	return b
+}
@@ -0,0 +1,100 @@
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// jsonlStore is the Store kept in inbox.jsonl, sent.jsonl, outbox.jsonl and
+// inbox_state.json. Every query reads the whole file; writers are
+// serialised with file locks.
+type jsonlStore struct {
+	dir string
+}
+
+// NewJSONLStore returns the JSONL-file store for the holler directory.
+func NewJSONLStore(hollerDir string) Store {
+	return &jsonlStore{dir: hollerDir}
+}
+
+func (s *jsonlStore) Backend() string {
+	return BackendJSONL
+}
+
+func (s *jsonlStore) path(box Mailbox) string {
+	if box == MailboxSent {
+		return SentPath(s.dir)
+	}
+	return InboxPath(s.dir)
+}
+
+func (s *jsonlStore) Append(box Mailbox, env *Envelope) error {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("marshal envelope: %w", err)
+	}
+	return appendToFile(s.path(box), data)
+}
+
+func (s *jsonlStore) Messages(box Mailbox, q Query) ([]*Envelope, error) {
+	envs, err := loadEnvelopes(s.path(box))
+	if err != nil {
+		return nil, err
+	}
+	var states map[string]MessageState
+	if q.needsState() {
+		if states, err = loadStates(StatePath(s.dir)); err != nil {
+			return nil, err
+		}
+	}
+	var matches []*Envelope
+	for _, env := range envs {
+		if q.Match(box, env, StateOf(states, env)) {
+			matches = append(matches, env)
+		}
+	}
+	return q.limit(matches), nil
+}
+
+func (s *jsonlStore) Outbox() ([]OutboxEntry, error) {
+	return loadOutbox(s.dir)
+}
+
+func (s *jsonlStore) Enqueue(entry OutboxEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshal outbox entry: %w", err)
+	}
+	return appendToFile(OutboxPath(s.dir), data)
+}
+
+// UpdateOutbox holds the outbox lock throughout, so entries queued by
+// another process can't be lost in between.
+func (s *jsonlStore) UpdateOutbox(fn func([]OutboxEntry) ([]OutboxEntry, error)) error {
+	return withLock(OutboxPath(s.dir), func() error {
+		entries, err := loadOutbox(s.dir)
+		if err != nil {
+			return err
+		}
+		if entries, err = fn(entries); err != nil {
+			return err
+		}
+		return writeOutbox(s.dir, entries)
+	})
+}
+
+func (s *jsonlStore) States() (map[string]MessageState, error) {
+	return loadStates(StatePath(s.dir))
+}
+
+func (s *jsonlStore) UpdateStates(envs []*Envelope, fn func(*MessageState)) error {
+	path := StatePath(s.dir)
+	return withLock(path, func() error {
+		states, err := loadStates(path)
+		if err != nil {
+			return err
+		}
+		applyState(states, envs, fn)
+		return writeStates(path, states)
+	})
+}
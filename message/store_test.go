@@ -0,0 +1,229 @@
+package message
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// TestStoreConcurrentWriters hammers both backends the way `holler send`,
+// receiving connections and the daemon's retry loop do at once: writers
+// queue outbox entries and append inbox messages while another goroutine
+// keeps rewriting the outbox. Nothing may be lost or duplicated.
+func TestStoreConcurrentWriters(t *testing.T) {
+	const (
+		writers   = 4
+		perWriter = 50
+		retrying  = 10 // entries already in the outbox, delivered one per retry cycle
+	)
+	backends := map[string]func(string) Store{
+		BackendJSONL: NewJSONLStore,
+		BackendBolt:  NewBoltStore,
+	}
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			st := open(t.TempDir())
+			body := strings.Repeat("x", 4096) // several writes' worth per record
+			for i := 0; i < retrying; i++ {
+				if err := st.Enqueue(NewOutboxEntry(testEnvelope(fmt.Sprintf("retry-%d", i), body), nil)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var writing sync.WaitGroup
+			errs := make(chan error, writers*perWriter*2)
+			for w := 0; w < writers; w++ {
+				writing.Add(1)
+				go func(w int) {
+					defer writing.Done()
+					for i := 0; i < perWriter; i++ {
+						id := fmt.Sprintf("w%d-%d", w, i)
+						errs <- st.Enqueue(NewOutboxEntry(testEnvelope(id, body), nil))
+						errs <- st.Append(MailboxInbox, testEnvelope(id, body))
+					}
+				}(w)
+			}
+			done := make(chan struct{})
+			go func() {
+				writing.Wait()
+				close(done)
+			}()
+
+			// Retry cycles run until the writers are through: every entry is
+			// attempted and, while any are left, one of the old ones is
+			// delivered. Each cycle holds the outbox for a moment, as a real
+			// one does, and pauses after so the writers aren't starved of
+			// the lock: bolt polls for it rather than queueing.
+			for r := 0; ; r++ {
+				delivered := fmt.Sprintf("retry-%d", r)
+				err := st.UpdateOutbox(func(entries []OutboxEntry) ([]OutboxEntry, error) {
+					time.Sleep(time.Millisecond)
+					var kept []OutboxEntry
+					for _, entry := range entries {
+						if entry.Envelope.ID != delivered {
+							entry.Attempts++
+							kept = append(kept, entry)
+						}
+					}
+					return kept, nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				select {
+				case <-done:
+				case <-time.After(time.Millisecond):
+					continue
+				}
+				if r >= retrying {
+					break
+				}
+			}
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			entries, err := st.Outbox()
+			if err != nil {
+				t.Fatal(err)
+			}
+			queued := make(map[string]int)
+			for _, entry := range entries {
+				queued[entry.Envelope.ID]++
+				if entry.Envelope.Body != body {
+					t.Errorf("outbox entry %s has a damaged body", entry.Envelope.ID)
+				}
+			}
+			inbox, err := st.Messages(MailboxInbox, Query{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			stored := make(map[string]int)
+			for _, env := range inbox {
+				stored[env.ID]++
+				if env.Body != body {
+					t.Errorf("inbox message %s has a damaged body", env.ID)
+				}
+			}
+
+			for w := 0; w < writers; w++ {
+				for i := 0; i < perWriter; i++ {
+					id := fmt.Sprintf("w%d-%d", w, i)
+					if queued[id] != 1 {
+						t.Errorf("outbox has %s %d times, want once", id, queued[id])
+					}
+					if stored[id] != 1 {
+						t.Errorf("inbox has %s %d times, want once", id, stored[id])
+					}
+				}
+			}
+			if len(entries) != writers*perWriter {
+				t.Errorf("outbox has %d entries, want %d", len(entries), writers*perWriter)
+			}
+			if len(inbox) != writers*perWriter {
+				t.Errorf("inbox has %d messages, want %d", len(inbox), writers*perWriter)
+			}
+		})
+	}
+}
+
+func testEnvelope(id, body string) *Envelope {
+	env := NewEnvelope("sender", "recipient", "message", body)
+	env.ID = id
+	return env
+}
+
+// TestStoreStatesPerSender checks that two senders using the same message
+// ID get their own state, and that a state saved by ID alone still applies
+// until it is next updated.
+func TestStoreStatesPerSender(t *testing.T) {
+	backends := map[string]func(string) Store{
+		BackendJSONL: NewJSONLStore,
+		BackendBolt:  NewBoltStore,
+	}
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			st := open(dir)
+			alice := NewEnvelope("alice", "me", "message", "from alice")
+			alice.ID = "job-1"
+			bob := NewEnvelope("bob", "me", "message", "from bob")
+			bob.ID = "job-1"
+			for _, env := range []*Envelope{alice, bob} {
+				if err := st.Append(MailboxInbox, env); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := st.UpdateStates([]*Envelope{alice}, func(s *MessageState) { s.Read = true }); err != nil {
+				t.Fatal(err)
+			}
+			states, err := st.States()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !StateOf(states, alice).Read || StateOf(states, bob).Read {
+				t.Fatalf("alice read %v, bob read %v; want only alice's read", StateOf(states, alice).Read, StateOf(states, bob).Read)
+			}
+			unread, err := st.Messages(MailboxInbox, Query{Unread: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(unread) != 1 || unread[0].From != "bob" {
+				t.Fatalf("unread = %v, want bob's message", unread)
+			}
+
+			// A state saved by ID alone applies to both until one is updated.
+			if err := st.UpdateStates([]*Envelope{alice}, func(s *MessageState) { s.Read = false }); err != nil {
+				t.Fatal(err)
+			}
+			if err := putLegacyState(st, "job-1", MessageState{Labels: []string{"old"}}); err != nil {
+				t.Fatal(err)
+			}
+			if err := st.UpdateStates([]*Envelope{bob}, func(s *MessageState) { s.Archived = true }); err != nil {
+				t.Fatal(err)
+			}
+			states, err = st.States()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b := StateOf(states, bob); !b.Archived || !b.HasLabel("old") {
+				t.Errorf("bob's state %+v, want archived with the old label", b)
+			}
+			if _, ok := states["job-1"]; ok {
+				t.Errorf("state saved by ID alone was not moved: %v", states)
+			}
+		})
+	}
+}
+
+// putLegacyState saves a state keyed by message ID alone, as stores did
+// before states were keyed by sender.
+func putLegacyState(st Store, id string, state MessageState) error {
+	switch st := st.(type) {
+	case *jsonlStore:
+		path := StatePath(st.dir)
+		states, err := loadStates(path)
+		if err != nil {
+			return err
+		}
+		states[id] = state
+		return writeStates(path, states)
+	case *boltStore:
+		return st.update(func(tx *bolt.Tx) error {
+			b, err := tx.CreateBucketIfNotExists(bucketState)
+			if err != nil {
+				return err
+			}
+			return putState(b, id, state)
+		})
+	}
+	return fmt.Errorf("unknown store %T", st)
+}
@@ -0,0 +1,120 @@
+package message
+
+import (
+	"sort"
+)
+
+// ThreadMessage is a message of a thread and the mailbox it was found in.
+type ThreadMessage struct {
+	Mailbox  Mailbox
+	Envelope *Envelope
+}
+
+// ThreadSummary describes one conversation across the inbox and sent log.
+type ThreadSummary struct {
+	ID           string
+	Participants []string // peer onion addresses, sorted
+	Messages     int
+	Unread       int
+	First        *Envelope // the message that started it, else the earliest
+	LastTs       int64     // timestamp of the latest message
+}
+
+// ThreadKey returns the thread env belongs to. Messages sent without a
+// thread ID start their own thread, keyed by their ID.
+func ThreadKey(env *Envelope) string {
+	if env.ThreadID != "" {
+		return env.ThreadID
+	}
+	return env.ID
+}
+
+// Thread returns the messages of thread id from the inbox and the sent log,
+// oldest first. A message found in both, such as one sent to ourselves, is
+// returned once.
+func Thread(st Store, id string) ([]ThreadMessage, error) {
+	var msgs []ThreadMessage
+	seen := make(map[string]bool)
+	for _, box := range []Mailbox{MailboxInbox, MailboxSent} {
+		envs, err := st.Messages(box, Query{ThreadID: id})
+		if err != nil {
+			return nil, err
+		}
+		// The first message of a thread may predate thread IDs.
+		roots, err := st.Messages(box, Query{ID: id})
+		if err != nil {
+			return nil, err
+		}
+		for _, env := range append(envs, roots...) {
+			if ThreadKey(env) != id || seen[env.Key()] {
+				continue
+			}
+			seen[env.Key()] = true
+			msgs = append(msgs, ThreadMessage{Mailbox: box, Envelope: env})
+		}
+	}
+	sort.SliceStable(msgs, func(i, j int) bool {
+		return msgs[i].Envelope.Ts < msgs[j].Envelope.Ts
+	})
+	return msgs, nil
+}
+
+// Threads summarises every thread in the inbox and the sent log, most
+// recently active first.
+func Threads(st Store) ([]*ThreadSummary, error) {
+	states, err := st.States()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*ThreadSummary)
+	peers := make(map[string]map[string]bool)
+	seen := make(map[string]bool)
+	for _, box := range []Mailbox{MailboxInbox, MailboxSent} {
+		envs, err := st.Messages(box, Query{})
+		if err != nil {
+			return nil, err
+		}
+		for _, env := range envs {
+			if seen[env.Key()] {
+				continue
+			}
+			seen[env.Key()] = true
+			key := ThreadKey(env)
+			t := byID[key]
+			if t == nil {
+				t = &ThreadSummary{ID: key}
+				byID[key] = t
+				peers[key] = make(map[string]bool)
+			}
+			t.Messages++
+			if box == MailboxInbox && !StateOf(states, env).Read {
+				t.Unread++
+			}
+			// Timestamps only have second resolution, so the thread's own
+			// ID beats an equally old reply.
+			if t.First == nil || env.ID == key || (t.First.ID != key && env.Ts < t.First.Ts) {
+				t.First = env
+			}
+			if env.Ts > t.LastTs {
+				t.LastTs = env.Ts
+			}
+			peers[key][peerOf(box, env)] = true
+		}
+	}
+
+	threads := make([]*ThreadSummary, 0, len(byID))
+	for key, t := range byID {
+		for p := range peers[key] {
+			t.Participants = append(t.Participants, p)
+		}
+		sort.Strings(t.Participants)
+		threads = append(threads, t)
+	}
+	sort.Slice(threads, func(i, j int) bool {
+		if threads[i].LastTs != threads[j].LastTs {
+			return threads[i].LastTs > threads[j].LastTs
+		}
+		return threads[i].ID < threads[j].ID
+	})
+	return threads, nil
+}
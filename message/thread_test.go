@@ -0,0 +1,45 @@
+package message
+
+import "testing"
+
+// TestThreadSharedIDs checks that messages from different senders that
+// share an ID are both part of the thread, while a message found in both
+// mailboxes is listed once.
+func TestThreadSharedIDs(t *testing.T) {
+	st := NewJSONLStore(t.TempDir())
+	msg := func(from, to, id, body string) *Envelope {
+		env := NewEnvelope(from, to, "message", body)
+		env.ID, env.ThreadID = id, "t1"
+		return env
+	}
+	add := func(box Mailbox, env *Envelope) {
+		if err := st.Append(box, env); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add(MailboxInbox, msg("alice", "me", "job-1", "from alice"))
+	add(MailboxInbox, msg("bob", "me", "job-1", "from bob"))
+	self := msg("me", "me", "note", "to myself")
+	add(MailboxInbox, self)
+	add(MailboxSent, self)
+
+	msgs, err := Thread(st, "t1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bodies := make(map[string]int)
+	for _, m := range msgs {
+		bodies[m.Envelope.Body]++
+	}
+	if len(msgs) != 3 || bodies["from alice"] != 1 || bodies["from bob"] != 1 || bodies["to myself"] != 1 {
+		t.Fatalf("thread has %v, want each message once", bodies)
+	}
+
+	threads, err := Threads(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(threads) != 1 || threads[0].Messages != 3 {
+		t.Fatalf("threads = %+v, want one thread of 3 messages", threads)
+	}
+}
@@ -0,0 +1,138 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/1F47E/holler/message"
+)
+
+// helloTimeout bounds the wait for the receiver's hello. Peers that predate
+// negotiation drop the connection on the unrecognised frame, so this only
+// comes into play for peers that stall.
+const helloTimeout = 15 * time.Second
+
+// ErrNoReply marks an exchange where the envelope was written but no reply
+// came back: the peer may well have stored it.
+var ErrNoReply = errors.New("no reply received")
+
+// Client is the sending side of a message-port connection. Connect opens
+// with a hello and falls back to the single-frame protocol for peers that
+// don't answer one.
+type Client struct {
+	Hello Hello // agreed protocol; zero for a legacy peer
+
+	tr     Transport
+	addr   string
+	legacy bool
+	conn   net.Conn // nil once a non-session connection has been used
+}
+
+// Connect dials addr's message port and negotiates the protocol.
+func Connect(ctx context.Context, tr Transport, addr string) (*Client, error) {
+	c := &Client{tr: tr, addr: addr}
+	if err := c.dial(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Legacy reports whether the peer predates protocol negotiation.
+func (c *Client) Legacy() bool {
+	return c.legacy
+}
+
+// SigVersion returns the envelope signature version the peer verifies: v2
+// if it advertised sig-v2, v1 for older and legacy peers.
+func (c *Client) SigVersion() int {
+	if !c.legacy && c.Hello.Has(FeatureSigV2) {
+		return message.V2
+	}
+	return message.V1
+}
+
+// Exchange sends env and returns the peer's reply. Without the session
+// feature each exchange gets its own connection, dialled as needed.
+func (c *Client) Exchange(ctx context.Context, env *message.Envelope) (*message.Envelope, error) {
+	if c.conn == nil {
+		if err := c.dial(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if err := SendTor(c.conn, env); err != nil {
+		c.drop()
+		return nil, err
+	}
+	reply, err := RecvTor(c.conn)
+	if err != nil || !c.Hello.Has(FeatureSession) {
+		c.drop()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoReply, err)
+	}
+	return reply, nil
+}
+
+// Close closes the connection, if one is open.
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// dial opens a connection and, unless the peer is known to be legacy,
+// negotiates on it. A failed negotiation marks the peer legacy and redials,
+// since the peer has already dropped or given up on the first connection.
+func (c *Client) dial(ctx context.Context) error {
+	conn, err := c.tr.Dial(ctx, c.addr, torMsgPort)
+	if err != nil {
+		return err
+	}
+	if c.legacy {
+		c.conn = conn
+		return nil
+	}
+
+	hello, err := negotiate(conn)
+	if err == nil {
+		c.conn, c.Hello = conn, hello
+		logf("tor: %s.onion: protocol v%d, features %v", shortOnion(c.addr), hello.Version(), hello.Features)
+		return nil
+	}
+	conn.Close()
+	logf("tor: %s.onion: no hello (%v), falling back to legacy protocol", shortOnion(c.addr), err)
+
+	c.legacy = true
+	conn, err = c.tr.Dial(ctx, c.addr, torMsgPort)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	return nil
+}
+
+func (c *Client) drop() {
+	c.conn.Close()
+	c.conn = nil
+}
+
+// negotiate sends our hello and checks the receiver's answer.
+func negotiate(conn net.Conn) (Hello, error) {
+	if err := SendHello(conn, LocalHello()); err != nil {
+		return Hello{}, err
+	}
+	agreed, err := RecvHello(conn, helloTimeout)
+	if err != nil {
+		return Hello{}, err
+	}
+	if agreed.Version() == 0 {
+		return Hello{}, fmt.Errorf("no common protocol version")
+	}
+	return agreed, nil
+}
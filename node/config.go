@@ -0,0 +1,80 @@
+package node
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/1F47E/holler/message"
+)
+
+// Config is the optional ~/.holler/config.json format. It tunes the receive
+// path; every field falls back to its default when zero or missing.
+type Config struct {
+	MaxClockSkewSec  int `json:"max_clock_skew_sec"`  // how far in the future an envelope's ts may be
+	MaxMessageAgeSec int `json:"max_message_age_sec"` // how far in the past an envelope's ts may be
+	SeenCacheSize    int `json:"seen_cache_size"`     // envelopes remembered at once for replay detection
+	MaxConns         int `json:"max_conns"`           // concurrent inbound connections
+	RatePerMin       int `json:"rate_per_min"`        // messages per minute per sender
+	RateBurst        int `json:"rate_burst"`          // burst allowance per sender
+	HeaderTimeoutSec int `json:"header_timeout_sec"`  // time allowed to send the 4-byte length prefix
+}
+
+const (
+	defaultMaxClockSkew  = 5 * time.Minute
+	defaultMaxMessageAge = 72 * time.Hour // outbox retries can hold a message this long
+	defaultMaxConns      = 64
+	defaultRatePerMin    = 60
+	defaultRateBurst     = 20
+	defaultHeaderTimeout = 10 * time.Second
+)
+
+// LoadConfig reads config.json from the holler directory.
+// Returns defaults if the file doesn't exist or is malformed.
+func LoadConfig(hollerDir string) Config {
+	var c Config
+	data, err := os.ReadFile(filepath.Join(hollerDir, "config.json"))
+	if err == nil {
+		if err := json.Unmarshal(data, &c); err != nil {
+			c = Config{}
+		}
+	}
+	if c.MaxClockSkewSec <= 0 {
+		c.MaxClockSkewSec = int(defaultMaxClockSkew / time.Second)
+	}
+	if c.MaxMessageAgeSec <= 0 {
+		c.MaxMessageAgeSec = int(defaultMaxMessageAge / time.Second)
+	}
+	if c.SeenCacheSize <= 0 {
+		c.SeenCacheSize = message.DefaultSeenCacheSize
+	}
+	if c.MaxConns <= 0 {
+		c.MaxConns = defaultMaxConns
+	}
+	if c.RatePerMin <= 0 {
+		c.RatePerMin = defaultRatePerMin
+	}
+	if c.RateBurst <= 0 {
+		c.RateBurst = defaultRateBurst
+	}
+	if c.HeaderTimeoutSec <= 0 {
+		c.HeaderTimeoutSec = int(defaultHeaderTimeout / time.Second)
+	}
+	return c
+}
+
+// MaxClockSkew returns MaxClockSkewSec as a duration.
+func (c Config) MaxClockSkew() time.Duration {
+	return time.Duration(c.MaxClockSkewSec) * time.Second
+}
+
+// MaxMessageAge returns MaxMessageAgeSec as a duration.
+func (c Config) MaxMessageAge() time.Duration {
+	return time.Duration(c.MaxMessageAgeSec) * time.Second
+}
+
+// HeaderTimeout returns HeaderTimeoutSec as a duration.
+func (c Config) HeaderTimeout() time.Duration {
+	return time.Duration(c.HeaderTimeoutSec) * time.Second
+}
@@ -0,0 +1,193 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cretz/bine/control"
+)
+
+const loopbackDirName = "holler-loopback"
+
+// LoopbackTransport connects agents on the same machine over 127.0.0.1
+// without Tor. A listening agent records its local ports in a registry
+// directory shared by every holler process on the machine, keyed by onion
+// address; dialers look the address up there instead of going through SOCKS5.
+type LoopbackTransport struct {
+	Dir string // registry directory
+}
+
+// loopbackEntry is the registry file format: <dir>/<onion>.json.
+type loopbackEntry struct {
+	MsgPort  int `json:"msg_port"`
+	HTTPPort int `json:"http_port"`
+	PID      int `json:"pid"`
+}
+
+// NewLoopbackTransport returns a LoopbackTransport using dir as its registry.
+// An empty dir selects $TMPDIR/holler-loopback.
+func NewLoopbackTransport(dir string) *LoopbackTransport {
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), loopbackDirName)
+	}
+	return &LoopbackTransport{Dir: dir}
+}
+
+// Name implements Transport.
+func (t *LoopbackTransport) Name() string { return TransportLoopback }
+
+// CheckDial implements Transport. Loopback dialing has no prerequisites.
+func (t *LoopbackTransport) CheckDial() error { return nil }
+
+// CheckListen implements Transport by ensuring the registry is writable.
+func (t *LoopbackTransport) CheckListen() error {
+	if err := os.MkdirAll(t.Dir, 0700); err != nil {
+		return fmt.Errorf("loopback: create registry: %w", err)
+	}
+	return nil
+}
+
+// Dial connects to the local listener registered for onionAddr.
+func (t *LoopbackTransport) Dial(ctx context.Context, onionAddr string, port int) (net.Conn, error) {
+	entry, err := t.lookup(onionAddr)
+	if err != nil {
+		return nil, err
+	}
+	var localPort int
+	switch port {
+	case torMsgPort:
+		localPort = entry.MsgPort
+	case torHTTPPort:
+		localPort = entry.HTTPPort
+	default:
+		return nil, fmt.Errorf("loopback dial: %s has no port %d", onionAddr, port)
+	}
+	target := fmt.Sprintf("127.0.0.1:%d", localPort)
+	logf("loopback: dialing %s.onion:%d via %s", onionAddr, port, target)
+
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", target)
+}
+
+// Listen binds the message and homepage ports on 127.0.0.1 and registers
+// them under onionAddr. The key is unused; loopback does not authenticate
+// the address beyond envelope signatures.
+func (t *LoopbackTransport) Listen(_ *control.ED25519Key, onionAddr string) (Listener, error) {
+	if err := t.CheckListen(); err != nil {
+		return nil, err
+	}
+	msgLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("loopback: bind message listener: %w", err)
+	}
+	httpLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		msgLn.Close()
+		return nil, fmt.Errorf("loopback: bind http listener: %w", err)
+	}
+
+	ln := &loopbackNode{
+		path: t.entryPath(onionAddr),
+		addr: onionAddr,
+		entry: loopbackEntry{
+			MsgPort:  msgLn.Addr().(*net.TCPAddr).Port,
+			HTTPPort: httpLn.Addr().(*net.TCPAddr).Port,
+			PID:      os.Getpid(),
+		},
+		msgListener:  msgLn,
+		httpListener: httpLn,
+	}
+	if err := ln.register(); err != nil {
+		msgLn.Close()
+		httpLn.Close()
+		return nil, err
+	}
+	logf("loopback: %s.onion registered (msg %d, http %d)", onionAddr, ln.entry.MsgPort, ln.entry.HTTPPort)
+	return ln, nil
+}
+
+func (t *LoopbackTransport) entryPath(onionAddr string) string {
+	return filepath.Join(t.Dir, strings.ToLower(onionAddr)+".json")
+}
+
+func (t *LoopbackTransport) lookup(onionAddr string) (loopbackEntry, error) {
+	var entry loopbackEntry
+	data, err := os.ReadFile(t.entryPath(onionAddr))
+	if os.IsNotExist(err) {
+		return entry, fmt.Errorf("loopback dial: %s.onion is not listening", onionAddr)
+	}
+	if err != nil {
+		return entry, fmt.Errorf("loopback dial: read registry: %w", err)
+	}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return entry, fmt.Errorf("loopback dial: parse registry: %w", err)
+	}
+	return entry, nil
+}
+
+// loopbackNode is the Listener returned by LoopbackTransport.
+type loopbackNode struct {
+	path         string
+	addr         string
+	entry        loopbackEntry
+	msgListener  net.Listener
+	httpListener net.Listener
+}
+
+func (ln *loopbackNode) register() error {
+	data, err := json.Marshal(ln.entry)
+	if err != nil {
+		return fmt.Errorf("loopback: marshal registry: %w", err)
+	}
+	tmp := ln.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("loopback: write registry: %w", err)
+	}
+	return os.Rename(tmp, ln.path)
+}
+
+// owned reports whether the registry file still points at this listener.
+func (ln *loopbackNode) owned() bool {
+	data, err := os.ReadFile(ln.path)
+	if err != nil {
+		return false
+	}
+	var cur loopbackEntry
+	if err := json.Unmarshal(data, &cur); err != nil {
+		return false
+	}
+	return cur == ln.entry
+}
+
+func (ln *loopbackNode) Addr() string                 { return ln.addr }
+func (ln *loopbackNode) AcceptMsg() (net.Conn, error) { return ln.msgListener.Accept() }
+func (ln *loopbackNode) HTTPListener() net.Listener   { return ln.httpListener }
+
+// Ping fails once another process has taken over the registration.
+func (ln *loopbackNode) Ping() error {
+	if !ln.owned() {
+		return fmt.Errorf("loopback: registration for %s.onion lost", ln.addr)
+	}
+	return nil
+}
+
+func (ln *loopbackNode) Close() error {
+	var firstErr error
+	if ln.owned() {
+		if err := os.Remove(ln.path); err != nil && !os.IsNotExist(err) {
+			firstErr = fmt.Errorf("loopback: unregister: %w", err)
+		}
+	}
+	if err := ln.msgListener.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	if err := ln.httpListener.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
@@ -0,0 +1,45 @@
+package node
+
+// Nack reason codes, carried in meta.code of a signed "nack" envelope whose
+// body is the ID of the rejected envelope. meta.reason holds a human-readable
+// explanation.
+const (
+	NackBadSignature   = "bad_signature"
+	NackWrongRecipient = "wrong_recipient"
+	NackClockSkew      = "clock_skew"
+	NackDuplicate      = "duplicate" // sent by older receivers instead of a second ack; means delivered
+	NackPolicy         = "policy_rejected"
+	NackPoWRequired    = "pow_required" // meta.pow holds the required difficulty
+	NackTooLarge       = "too_large"
+	NackMalformed      = "malformed"
+	NackRateLimited    = "rate_limited"
+	NackStorage        = "storage_failure"
+	NackIDConflict     = "id_conflict" // the sender already used the ID for another message
+	NackInProgress     = "in_progress" // the same envelope is being stored on another connection
+)
+
+// NackPermanent reports whether resending the same envelope can never
+// succeed. Rate limits and storage failures are transient; unknown codes are
+// treated as transient so newer peers can add codes without losing messages.
+func NackPermanent(code string) bool {
+	switch code {
+	case NackBadSignature, NackWrongRecipient, NackClockSkew, NackDuplicate, NackPolicy,
+		NackPoWRequired, NackTooLarge, NackMalformed, NackIDConflict:
+		return true
+	}
+	return false
+}
+
+// rejection is an admission failure: the counter to bump and the nack to send.
+type rejection struct {
+	stat   string
+	code   string
+	reason string
+	pow    int // proof-of-work difficulty the sender must meet, for NackPoWRequired
+}
+
+func (r *rejection) Error() string { return r.reason }
+
+func reject(stat, code, reason string) *rejection {
+	return &rejection{stat: stat, code: code, reason: reason}
+}
@@ -10,8 +10,9 @@ import (
 // Verbose enables debug logging (set by --verbose flag).
 var Verbose bool
 
-// MessageHandler processes a received, verified envelope.
-type MessageHandler func(env *message.Envelope)
+// MessageHandler processes a received, verified envelope. An error means the
+// message was not stored; the sender gets a storage_failure nack and may retry.
+type MessageHandler func(env *message.Envelope) error
 
 func logf(format string, args ...interface{}) {
 	if Verbose {
@@ -0,0 +1,68 @@
+package node
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/1F47E/holler/identity"
+)
+
+// policyCache holds policy.json and contacts.json for the receive path.
+// Each file is re-read only when its modification time or size changes, so
+// edits made with `holler policy` or `holler contacts` still apply to a
+// running daemon without a disk read per envelope.
+type policyCache struct {
+	mu          sync.Mutex
+	policy      *identity.Policy
+	contacts    identity.Contacts
+	policyStat  fileStamp
+	contactStat fileStamp
+}
+
+// fileStamp identifies one version of a file; the zero value never matches.
+type fileStamp struct {
+	ok      bool
+	exists  bool
+	modTime time.Time
+	size    int64
+}
+
+// stampFile returns path's current stamp. A missing file gets a stamp of
+// its own, so creating it is noticed.
+func stampFile(path string, err error) fileStamp {
+	if err != nil {
+		return fileStamp{}
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{ok: true}
+	}
+	return fileStamp{ok: true, exists: true, modTime: fi.ModTime(), size: fi.Size()}
+}
+
+// load returns the current policy and contacts, re-reading whichever file
+// changed since the last call. A file that fails to load is retried on the
+// next call.
+func (c *policyCache) load() (*identity.Policy, identity.Contacts, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if st := stampFile(identity.PolicyPath()); !st.ok || st != c.policyStat {
+		policy, err := identity.LoadPolicy()
+		if err != nil {
+			c.policyStat = fileStamp{}
+			return nil, nil, err
+		}
+		c.policy, c.policyStat = policy, st
+	}
+	if st := stampFile(identity.ContactsPath()); !st.ok || st != c.contactStat {
+		contacts, err := identity.LoadContacts()
+		if err != nil {
+			c.contactStat = fileStamp{}
+			return nil, nil, err
+		}
+		c.contacts, c.contactStat = contacts, st
+	}
+	return c.policy, c.contacts, nil
+}
@@ -0,0 +1,397 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	bineed25519 "github.com/cretz/bine/torutil/ed25519"
+
+	"github.com/1F47E/holler/identity"
+	"github.com/1F47E/holler/message"
+)
+
+// Receiver validates incoming envelopes and dispatches accepted ones to its
+// handler. An envelope is accepted only if its signature verifies, it is
+// addressed to Addr, its timestamp is inside the configured window, its
+// sender is within its rate limit and the sender policy allows it
+// (including any proof-of-work it demands from strangers). Accepted messages
+// from unknown senders are queued in requests.jsonl instead when the policy
+// is in quarantine mode. A copy of an envelope that is already stored, with
+// the same sender and signature, is acknowledged again without reaching the
+// handler, so a sender that missed the first ack stops retrying and nothing
+// is processed twice.
+type Receiver struct {
+	Dir     string // holler data directory
+	Addr    string // our 56-char onion address
+	KeyPair bineed25519.KeyPair
+	Handler MessageHandler
+	Seen    *message.SeenStore
+	Config  Config
+
+	conns   chan struct{} // semaphore bounding concurrent connections
+	limiter *rateLimiter  // per-sender token buckets
+	policy  policyCache   // policy.json and contacts.json
+}
+
+// NewReceiver builds a Receiver for the identity in hollerDir, loading
+// config.json and the persistent seen-ID store.
+func NewReceiver(hollerDir, addr string, kp bineed25519.KeyPair, handler MessageHandler) (*Receiver, error) {
+	cfg := LoadConfig(hollerDir)
+	seen, err := message.OpenSeenStore(hollerDir, cfg.MaxMessageAge(), cfg.SeenCacheSize)
+	if err != nil {
+		return nil, err
+	}
+	return &Receiver{
+		Dir:     hollerDir,
+		Addr:    addr,
+		KeyPair: kp,
+		Handler: handler,
+		Seen:    seen,
+		Config:  cfg,
+		conns:   make(chan struct{}, cfg.MaxConns),
+		limiter: newRateLimiter(cfg.RatePerMin, cfg.RateBurst),
+	}, nil
+}
+
+// Serve accepts incoming connections on the listener's message port and
+// dispatches verified messages to the handler. Runs until ctx is cancelled.
+func (r *Receiver) Serve(ctx context.Context, ln Listener) {
+	for {
+		conn, err := ln.AcceptMsg()
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+				logf("tor: accept error: %v", err)
+				continue
+			}
+		}
+
+		select {
+		case r.conns <- struct{}{}:
+		default:
+			count(StatConnLimit)
+			fmt.Fprintf(os.Stderr, "recv: connection limit (%d) reached, dropping connection\n", cap(r.conns))
+			conn.Close()
+			continue
+		}
+		go func() {
+			defer func() { <-r.conns }()
+			r.handleConn(conn)
+		}()
+	}
+}
+
+// handleConn serves one connection. A legacy peer sends a single bare
+// envelope; a peer that opens with a hello gets the agreed hello back and,
+// if both support sessions, may send envelopes until it closes the connection.
+func (r *Receiver) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	frame, ok := r.recvFrame(conn, false)
+	if !ok {
+		return
+	}
+
+	theirs, isHello := parseHello(frame)
+	if !isHello {
+		r.handleFrame(conn, frame, "ack")
+		return
+	}
+
+	agreed, ok := Negotiate(LocalHello(), theirs)
+	if err := SendHello(conn, agreed); err != nil || !ok {
+		logf("tor: hello: versions %v, agreed %v: %v", theirs.Versions, agreed.Versions, err)
+		return
+	}
+	logf("tor: hello: protocol v%d, features %v", agreed.Version(), agreed.Features)
+
+	ackType := "ack"
+	if agreed.Has(FeatureReceipts) {
+		ackType = message.ReceiptReceived
+	}
+	for {
+		frame, ok := r.recvFrame(conn, true)
+		if !ok || !r.handleFrame(conn, frame, ackType) || !agreed.Has(FeatureSession) {
+			return
+		}
+	}
+}
+
+// recvFrame reads the next frame. Oversized frames are nacked; in a session,
+// the peer hanging up between envelopes is the normal end and not an error.
+func (r *Receiver) recvFrame(conn net.Conn, inSession bool) ([]byte, bool) {
+	frame, err := recvFrame(conn, r.Config.HeaderTimeout())
+	if err == nil {
+		return frame, true
+	}
+	if errors.Is(err, errFrameTooLarge) {
+		r.rejectFrame(conn, reject(StatRecvError, NackTooLarge, err.Error()))
+		return nil, false
+	}
+	if !inSession || !errors.Is(err, io.EOF) {
+		count(StatRecvError)
+		logf("tor: recv error: %v", err)
+	}
+	return nil, false
+}
+
+// handleFrame decodes and handles one envelope frame. It returns false when
+// the connection should not carry any more envelopes.
+func (r *Receiver) handleFrame(conn net.Conn, frame []byte, ackType string) bool {
+	env, err := message.UnmarshalEnvelope(frame)
+	if err != nil {
+		r.rejectFrame(conn, reject(StatRecvError, NackMalformed, err.Error()))
+		return false
+	}
+	return r.handleEnvelope(conn, env, ackType)
+}
+
+// Admission outcomes for an envelope that check doesn't reject.
+const (
+	admitDeliver    = iota // hand to the handler
+	admitQuarantine        // hold in requests.jsonl
+	admitDuplicate         // already stored: acknowledge only
+)
+
+// handleEnvelope admits or rejects a single envelope and answers it with
+// ackType (ack, or a received receipt) or a nack. It returns false if the
+// connection is no longer usable.
+func (r *Receiver) handleEnvelope(conn net.Conn, env *message.Envelope, ackType string) bool {
+	admit, rej := r.check(env)
+	if rej == nil && admit != admitDuplicate {
+		rej = r.deliver(env, admit == admitQuarantine)
+	}
+	if rej != nil {
+		count(rej.stat)
+		logReject(env, rej)
+		return r.nack(conn, env, rej)
+	}
+	if admit == admitDuplicate {
+		count(StatDuplicate)
+		fmt.Fprintf(os.Stderr, "recv: duplicate %s from %s.onion already stored, acknowledged again\n", env.ID, shortOnion(env.From))
+	} else {
+		count(StatAccepted)
+	}
+	return r.reply(conn, env, ackType, nil)
+}
+
+// deliver hands an admitted envelope to the handler, or to the quarantine.
+// If it can't be stored its ID is forgotten again so a retry is accepted.
+func (r *Receiver) deliver(env *message.Envelope, quarantine bool) *rejection {
+	var err error
+	if quarantine {
+		err = r.quarantine(env)
+	} else {
+		err = r.Handler(env)
+	}
+	if err == nil {
+		return nil
+	}
+	if ferr := r.Seen.Forget(env.From, env.ID); ferr != nil {
+		logf("tor: seen store: %v", ferr)
+	}
+	return reject(StatStorage, NackStorage, "message could not be stored")
+}
+
+// nack answers env with a signed nack carrying rej's code and reason.
+func (r *Receiver) nack(conn net.Conn, env *message.Envelope, rej *rejection) bool {
+	meta := map[string]string{"code": rej.code, "reason": rej.reason}
+	if rej.pow > 0 {
+		meta["pow"] = strconv.Itoa(rej.pow)
+	}
+	return r.reply(conn, env, "nack", meta)
+}
+
+// rejectFrame nacks a frame that never became an envelope. The nack's body
+// is empty since there is no envelope ID to refer to.
+func (r *Receiver) rejectFrame(conn net.Conn, rej *rejection) {
+	count(rej.stat)
+	fmt.Fprintf(os.Stderr, "recv: rejected frame: %v\n", rej)
+	r.nack(conn, &message.Envelope{}, rej)
+}
+
+// reply sends a signed response of msgType to env on conn. The body carries
+// the ID of the envelope being answered. A sender that signs v2 can verify
+// it, so it is answered in v2.
+func (r *Receiver) reply(conn net.Conn, env *message.Envelope, msgType string, meta map[string]string) bool {
+	resp := message.NewEnvelope(r.Addr, env.From, msgType, env.ID)
+	if env.V == message.V2 {
+		resp.V = message.V2
+	}
+	resp.ThreadID = env.ThreadID
+	resp.Meta = meta
+	if err := resp.Sign(r.KeyPair); err != nil {
+		logf("tor: sign %s: %v", msgType, err)
+		return false
+	}
+	if err := SendTor(conn, resp); err != nil {
+		logf("tor: send %s: %v", msgType, err)
+		return false
+	}
+	return true
+}
+
+// check applies the admission rules in order, returning how an accepted
+// envelope is admitted, or why it is rejected. The ID is recorded as seen
+// only once every other check has passed.
+func (r *Receiver) check(env *message.Envelope) (int, *rejection) {
+	valid, err := env.Verify()
+	if err != nil || !valid {
+		return 0, reject(StatBadSignature, NackBadSignature, "invalid signature")
+	}
+	if env.To != r.Addr {
+		return 0, reject(StatWrongRecipient, NackWrongRecipient, fmt.Sprintf("addressed to %s", env.To))
+	}
+
+	now := time.Now()
+	ts := time.Unix(env.Ts, 0)
+	if ts.After(now.Add(r.Config.MaxClockSkew())) {
+		return 0, reject(StatClockSkew, NackClockSkew, fmt.Sprintf("timestamp %s is in the future", ts.Format(time.RFC3339)))
+	}
+	if ts.Before(now.Add(-r.Config.MaxMessageAge())) {
+		return 0, reject(StatClockSkew, NackClockSkew, fmt.Sprintf("timestamp %s is too old", ts.Format(time.RFC3339)))
+	}
+	// Rate limit first, so senders the policy turns away can't make us
+	// check the policy and sign a nack as fast as they can send.
+	if !r.limiter.allow(env.From, now) {
+		return 0, reject(StatRateLimited, NackRateLimited, fmt.Sprintf("rate limit of %d/min exceeded", r.Config.RatePerMin))
+	}
+	quarantine, rej := r.checkPolicy(env)
+	if rej != nil {
+		return 0, rej
+	}
+
+	// The seen store holds exactly the IDs that were stored: deliver
+	// forgets an ID again if storing it fails. Marking claims the ID, so two
+	// connections can't both store the same envelope.
+	fresh, err := r.Seen.Mark(env.From, env.ID, env.Ts)
+	if errors.Is(err, message.ErrSeenFull) {
+		return 0, reject(StatSeenFull, NackRateLimited, "receiver is busy, try again later")
+	}
+	if err != nil {
+		logf("tor: seen store: %v", err)
+	}
+	switch {
+	case !fresh:
+		return r.checkDuplicate(env)
+	case quarantine:
+		return admitQuarantine, nil
+	}
+	return admitDeliver, nil
+}
+
+// checkDuplicate decides an envelope whose sender and ID were seen before by
+// looking up the copy that was stored. A resend of the same message is acked
+// again even if it was re-signed; a different message reusing the ID is
+// refused, and one whose copy isn't stored yet is still being handled on
+// another connection.
+func (r *Receiver) checkDuplicate(env *message.Envelope) (int, *rejection) {
+	prev, err := r.stored(env)
+	switch {
+	case err != nil:
+		logf("tor: look up %s: %v", env.ID, err)
+		return 0, reject(StatStorage, NackStorage, "message store unavailable")
+	case prev == nil:
+		return 0, reject(StatInProgress, NackInProgress, "message is still being stored")
+	case !prev.SameMessage(env):
+		return 0, reject(StatIDConflict, NackIDConflict, fmt.Sprintf("ID %s was already used for another message", env.ID))
+	}
+	return admitDuplicate, nil
+}
+
+// stored returns the stored envelope from env's sender with env's ID, or nil
+// if there is none: receipts are kept in receipts.jsonl, everything else in
+// the inbox or, while quarantined, in requests.jsonl.
+func (r *Receiver) stored(env *message.Envelope) (*message.Envelope, error) {
+	var envs []*message.Envelope
+	if message.IsReceipt(env.Type) {
+		receipts, err := message.LoadReceipts(r.Dir)
+		if err != nil {
+			return nil, err
+		}
+		envs = receipts
+	} else {
+		st, err := message.OpenStore(r.Dir)
+		if err != nil {
+			return nil, err
+		}
+		inbox, err := st.Messages(message.MailboxInbox, message.Query{ID: env.ID, Peer: env.From})
+		if err != nil {
+			return nil, err
+		}
+		requests, err := message.LoadRequests(r.Dir)
+		if err != nil {
+			return nil, err
+		}
+		envs = append(inbox, requests...)
+	}
+	for _, prev := range envs {
+		if prev.ID == env.ID && prev.From == env.From {
+			return prev, nil
+		}
+	}
+	return nil, nil
+}
+
+// checkPolicy applies policy.json and reports whether the envelope must be
+// quarantined. The policy and contacts are re-read whenever their files
+// change, so edits made with `holler policy` apply to a running daemon. An
+// unreadable policy rejects everything rather than silently opening up, with
+// a transient nack: the sender retries once the file is fixed.
+func (r *Receiver) checkPolicy(env *message.Envelope) (bool, *rejection) {
+	policy, contacts, err := r.policy.load()
+	if err != nil {
+		logf("tor: load policy: %v", err)
+		return false, reject(StatStorage, NackStorage, "receiver policy unavailable")
+	}
+	if err := policy.Check(env.From, env.Type, len(env.Body), contacts); err != nil {
+		if errors.Is(err, identity.ErrTooLarge) {
+			return false, reject(StatPolicy, NackTooLarge, err.Error())
+		}
+		return false, reject(StatPolicy, NackPolicy, err.Error())
+	}
+	if need := policy.RequiredPoW(env.From, contacts); need > 0 && env.PoWBits() < need {
+		rej := reject(StatPoW, NackPoWRequired, fmt.Sprintf("proof-of-work of %d bits required", need))
+		rej.pow = need
+		return false, rej
+	}
+	return policy.Quarantines(env.From, env.Type, contacts), nil
+}
+
+// quarantine holds an envelope from an unknown sender in requests.jsonl
+// until `holler requests accept` or `deny` decides its fate.
+func (r *Receiver) quarantine(env *message.Envelope) error {
+	data, err := env.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := message.AppendToRequests(r.Dir, data); err != nil {
+		fmt.Fprintf(os.Stderr, "recv: quarantine %s: %v\n", env.ID, err)
+		return err
+	}
+	count(StatQuarantined)
+	logf("recv: quarantined %s from unknown sender %s", env.ID, env.From)
+	return nil
+}
+
+// logReject reports a rejected envelope. Unlike logf this is always on:
+// rejections are what an operator looks for when hunting replay attempts.
+func logReject(env *message.Envelope, reason error) {
+	fmt.Fprintf(os.Stderr, "recv: rejected %s from %s.onion: %v\n", env.ID, shortOnion(env.From), reason)
+}
+
+// shortOnion abbreviates an onion address for log lines.
+func shortOnion(addr string) string {
+	if len(addr) > 16 {
+		return addr[:16]
+	}
+	return addr
+}
@@ -0,0 +1,171 @@
+package node
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	bineed25519 "github.com/cretz/bine/torutil/ed25519"
+
+	"github.com/1F47E/holler/identity"
+	"github.com/1F47E/holler/message"
+)
+
+// testReceiver returns a receiver in a fresh holler dir that stores
+// envelopes in its inbox, and the key and address of a sender.
+func testReceiver(t *testing.T) (*Receiver, bineed25519.KeyPair, string) {
+	t.Helper()
+	dir := t.TempDir()
+	key, err := LoadOrCreateOnionKey(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	senderKey, err := LoadOrCreateOnionKey(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := message.NewJSONLStore(dir)
+	r, err := NewReceiver(dir, identity.OnionAddrFromKey(key), identity.OnionKeyPairFromBine(key), func(env *message.Envelope) error {
+		return st.Append(message.MailboxInbox, env)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, identity.OnionKeyPairFromBine(senderKey), identity.OnionAddrFromKey(senderKey)
+}
+
+func TestReceiverDuplicates(t *testing.T) {
+	r, kp, from := testReceiver(t)
+	orig := message.NewEnvelope(from, r.Addr, "message", "run the report")
+	orig.Meta = map[string]string{"task": "7"}
+	if err := orig.Sign(kp); err != nil {
+		t.Fatal(err)
+	}
+	// check reads the policy from the global holler dir.
+	defer func(d string) { identity.DirOverride = d }(identity.DirOverride)
+	identity.DirOverride = r.Dir
+
+	admit, rej := r.check(orig)
+	if rej != nil || admit != admitDeliver {
+		t.Fatalf("first copy: admit %d, %v", admit, rej)
+	}
+	if rej := r.deliver(orig, false); rej != nil {
+		t.Fatal(rej)
+	}
+
+	resign := func(mutate func(*message.Envelope)) *message.Envelope {
+		env := *orig
+		mutate(&env)
+		if err := env.Sign(kp); err != nil {
+			t.Fatal(err)
+		}
+		return &env
+	}
+	tests := []struct {
+		name string
+		env  *message.Envelope
+		code string // "" for an ack
+	}{
+		{"same envelope", orig, ""},
+		{"re-signed as v2", resign(func(e *message.Envelope) { e.V = message.V2 }), ""},
+		{"requeued with a new ts", resign(func(e *message.Envelope) { e.Ts++ }), ""},
+		{"different body", resign(func(e *message.Envelope) { e.Body = "delete everything" }), NackIDConflict},
+		{"different meta", resign(func(e *message.Envelope) { e.Meta = map[string]string{"task": "8"} }), NackIDConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admit, rej := r.check(tt.env)
+			switch {
+			case tt.code == "" && (rej != nil || admit != admitDuplicate):
+				t.Errorf("admit %d, %v; want a duplicate ack", admit, rej)
+			case tt.code != "" && (rej == nil || rej.code != tt.code):
+				t.Errorf("admit %d, %v; want nack %s", admit, rej, tt.code)
+			}
+		})
+	}
+
+	envs, err := message.NewJSONLStore(r.Dir).Messages(message.MailboxInbox, message.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(envs) != 1 {
+		t.Fatalf("inbox has %d messages, want 1", len(envs))
+	}
+}
+
+// TestReceiverUnreadablePolicy checks that a policy.json caught mid-edit
+// gets a nack the sender retries, not one that dead-letters the message.
+func TestReceiverUnreadablePolicy(t *testing.T) {
+	r, kp, from := testReceiver(t)
+	defer func(d string) { identity.DirOverride = d }(identity.DirOverride)
+	identity.DirOverride = r.Dir
+	path, err := identity.PolicyPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(`{"mode": "con`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	env := message.NewEnvelope(from, r.Addr, "message", "hello")
+	if err := env.Sign(kp); err != nil {
+		t.Fatal(err)
+	}
+	_, rej := r.check(env)
+	if rej == nil || NackPermanent(rej.code) {
+		t.Fatalf("got %v, want a transient nack", rej)
+	}
+}
+
+// TestReceiverPoWThreshold checks that a stranger's stamp must reach the
+// policy's difficulty exactly, and that contacts need none.
+func TestReceiverPoWThreshold(t *testing.T) {
+	const need = 8
+	r, kp, from := testReceiver(t)
+	defer func(d string) { identity.DirOverride = d }(identity.DirOverride)
+	identity.DirOverride = r.Dir
+	if err := identity.SavePolicy(&identity.Policy{Mode: identity.PolicyOpen, PoWDifficulty: need}); err != nil {
+		t.Fatal(err)
+	}
+
+	// stamped returns a signed envelope whose stamp has exactly bits
+	// leading zero bits, or none for bits 0.
+	stamped := func(bits int) *message.Envelope {
+		env := message.NewEnvelope(from, r.Addr, "message", "hello")
+		if err := env.Sign(kp); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; bits > 0 && env.PoWBits() != bits; i++ {
+			env.PoW = strconv.Itoa(i)
+		}
+		return env
+	}
+	tests := []struct {
+		name    string
+		env     *message.Envelope
+		contact bool
+		ok      bool
+	}{
+		{"no stamp", stamped(0), false, false},
+		{"one bit short", stamped(need - 1), false, false},
+		{"at the threshold", stamped(need), false, true},
+		{"above the threshold", stamped(need + 1), false, true},
+		{"contact without a stamp", stamped(0), true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.contact {
+				if err := identity.SaveContacts(identity.Contacts{"alice": from}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			admit, rej := r.check(tt.env)
+			switch {
+			case tt.ok && (rej != nil || admit != admitDeliver):
+				t.Errorf("admit %d, %v; want delivery", admit, rej)
+			case !tt.ok && (rej == nil || rej.code != NackPoWRequired || rej.pow != need):
+				t.Errorf("admit %d, %v; want nack %s asking for %d bits", admit, rej, NackPoWRequired, need)
+			}
+		})
+	}
+}
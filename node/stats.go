@@ -0,0 +1,92 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const statsFile = "stats.json"
+
+// Receive-path counter names.
+const (
+	StatAccepted       = "accepted"
+	StatDuplicate      = "duplicate" // already stored, acknowledged again
+	StatQuarantined    = "quarantined"
+	StatBadSignature   = "rejected_bad_signature"
+	StatWrongRecipient = "rejected_wrong_recipient"
+	StatClockSkew      = "rejected_clock_skew"
+	StatPolicy         = "rejected_policy"
+	StatPoW            = "rejected_pow"
+	StatConnLimit      = "rejected_conn_limit"
+	StatRateLimited    = "rejected_rate_limited"
+	StatSeenFull       = "rejected_seen_full" // too many recent envelopes to track
+	StatStorage        = "rejected_storage_failure"
+	StatIDConflict     = "rejected_id_conflict"
+	StatInProgress     = "rejected_in_progress"
+	StatRecvError      = "recv_errors"
+)
+
+var (
+	statsMu sync.Mutex
+	stats   = make(map[string]int64)
+)
+
+// count increments the named counter.
+func count(name string) {
+	statsMu.Lock()
+	stats[name]++
+	statsMu.Unlock()
+}
+
+// Stats returns a snapshot of the receive-path counters for this process.
+func Stats() map[string]int64 {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	snap := make(map[string]int64, len(stats))
+	for k, v := range stats {
+		snap[k] = v
+	}
+	return snap
+}
+
+// WriteStats saves the current counters to stats.json in the holler directory,
+// so `holler daemon status` can show them.
+func WriteStats(hollerDir string) error {
+	data, err := json.MarshalIndent(Stats(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal stats: %w", err)
+	}
+	path := filepath.Join(hollerDir, statsFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write stats: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadStats reads counters saved by WriteStats. Returns nil if none exist.
+func LoadStats(hollerDir string) map[string]int64 {
+	data, err := os.ReadFile(filepath.Join(hollerDir, statsFile))
+	if err != nil {
+		return nil
+	}
+	var s map[string]int64
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil
+	}
+	return s
+}
+
+// SortedStatNames returns the counter names in s, sorted.
+func SortedStatNames(s map[string]int64) []string {
+	names := make([]string, 0, len(s))
+	for k := range s {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -12,12 +12,30 @@ import (
 )
 
 const (
-	torSOCKSAddr     = "127.0.0.1:9050"
-	torControlAddr   = "127.0.0.1:9051"
-	torMsgPort       = 9000
-	torHTTPPort      = 80
+	torSOCKSAddr   = "127.0.0.1:9050"
+	torControlAddr = "127.0.0.1:9051"
+	torMsgPort     = 9000
+	torHTTPPort    = 80
 )
 
+// TorTransport dials peers through a Tor SOCKS5 proxy and publishes onion
+// services through the Tor control port.
+type TorTransport struct {
+	SOCKSAddr   string // SOCKS5 proxy, default 127.0.0.1:9050
+	ControlAddr string // control port, default 127.0.0.1:9051
+}
+
+// NewTorTransport returns a TorTransport using the default local Tor ports.
+func NewTorTransport() *TorTransport {
+	return &TorTransport{
+		SOCKSAddr:   torSOCKSAddr,
+		ControlAddr: torControlAddr,
+	}
+}
+
+// Name implements Transport.
+func (t *TorTransport) Name() string { return TransportTor }
+
 // TorNode holds the state for a Tor onion service with two ports.
 type TorNode struct {
 	OnionAddr    string // 56-char base32 service ID (no .onion)
@@ -26,12 +44,12 @@ type TorNode struct {
 	httpListener net.Listener // local TCP for port 80 (homepage)
 }
 
-// ListenTor creates a Tor onion service with two virtual ports:
+// Listen creates a Tor onion service with two virtual ports:
 //   - 9000 → holler message protocol
 //   - 80   → HTTP homepage
 //
 // Returns a TorNode with both listeners ready to Accept().
-func ListenTor(onionKey *control.ED25519Key, onionAddr string) (*TorNode, error) {
+func (t *TorTransport) Listen(onionKey *control.ED25519Key, onionAddr string) (Listener, error) {
 	// Start two local TCP listeners
 	msgLn, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
@@ -49,7 +67,7 @@ func ListenTor(onionKey *control.ED25519Key, onionAddr string) (*TorNode, error)
 	logf("tor: http listener on 127.0.0.1:%d", httpPort)
 
 	// Connect to Tor control port
-	textConn, err := textproto.Dial("tcp", torControlAddr)
+	textConn, err := textproto.Dial("tcp", t.ControlAddr)
 	if err != nil {
 		msgLn.Close()
 		httpLn.Close()
@@ -96,6 +114,11 @@ func ListenTor(onionKey *control.ED25519Key, onionAddr string) (*TorNode, error)
 	}, nil
 }
 
+// Addr returns the onion service ID this node is published under.
+func (tn *TorNode) Addr() string {
+	return tn.OnionAddr
+}
+
 // AcceptMsg waits for the next incoming TCP connection on the message port (9000).
 func (tn *TorNode) AcceptMsg() (net.Conn, error) {
 	return tn.msgListener.Accept()
@@ -138,12 +161,12 @@ func (tn *TorNode) Ping() error {
 	return nil
 }
 
-// DialTor connects to a remote onion address via Tor SOCKS5 proxy.
-func DialTor(ctx context.Context, onionAddr string, port int) (net.Conn, error) {
+// Dial connects to a remote onion address via Tor SOCKS5 proxy.
+func (t *TorTransport) Dial(ctx context.Context, onionAddr string, port int) (net.Conn, error) {
 	target := fmt.Sprintf("%s.onion:%d", onionAddr, port)
 	logf("tor: dialing %s via SOCKS5", target)
 
-	dialer, err := proxy.SOCKS5("tcp", torSOCKSAddr, nil, proxy.Direct)
+	dialer, err := proxy.SOCKS5("tcp", t.SOCKSAddr, nil, proxy.Direct)
 	if err != nil {
 		return nil, fmt.Errorf("tor dial: create SOCKS5 dialer: %w", err)
 	}
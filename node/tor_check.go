@@ -6,27 +6,27 @@ import (
 	"time"
 )
 
-// CheckTorSOCKS verifies the Tor SOCKS5 proxy is reachable (port 9050).
+// CheckDial verifies the Tor SOCKS5 proxy is reachable (port 9050).
 // Needed for dialing (send/ping).
-func CheckTorSOCKS() error {
-	conn, err := net.DialTimeout("tcp", "127.0.0.1:9050", 2*time.Second)
+func (t *TorTransport) CheckDial() error {
+	conn, err := net.DialTimeout("tcp", t.SOCKSAddr, 2*time.Second)
 	if err != nil {
-		return fmt.Errorf("Tor SOCKS5 proxy not reachable on 127.0.0.1:9050 — install and start tor:\n  macOS: brew install tor && brew services start tor\n  Linux: sudo apt install tor && sudo systemctl start tor")
+		return fmt.Errorf("Tor SOCKS5 proxy not reachable on %s — install and start tor:\n  macOS: brew install tor && brew services start tor\n  Linux: sudo apt install tor && sudo systemctl start tor", t.SOCKSAddr)
 	}
 	conn.Close()
 	logf("tor: SOCKS5 proxy reachable")
 	return nil
 }
 
-// CheckTorAvailable verifies both SOCKS5 (9050) and control (9051) ports.
+// CheckListen verifies both SOCKS5 (9050) and control (9051) ports.
 // Needed for listening (creating onion services).
-func CheckTorAvailable() error {
-	if err := CheckTorSOCKS(); err != nil {
+func (t *TorTransport) CheckListen() error {
+	if err := t.CheckDial(); err != nil {
 		return err
 	}
-	conn, err := net.DialTimeout("tcp", "127.0.0.1:9051", 2*time.Second)
+	conn, err := net.DialTimeout("tcp", t.ControlAddr, 2*time.Second)
 	if err != nil {
-		return fmt.Errorf("Tor control port not reachable on 127.0.0.1:9051 — enable it in torrc:\n  ControlPort 9051\n  CookieAuthentication 1")
+		return fmt.Errorf("Tor control port not reachable on %s — enable it in torrc:\n  ControlPort 9051\n  CookieAuthentication 1", t.ControlAddr)
 	}
 	conn.Close()
 	logf("tor: SOCKS5 and control port reachable")
@@ -10,14 +10,25 @@ import (
 	"os"
 	"path/filepath"
 	"time"
+
+	"github.com/1F47E/holler/identity"
 )
 
 // HomepageData is passed to the HTML template.
 type HomepageData struct {
-	Name      string
-	Bio       string
-	OnionAddr string
-	Version   string
+	Name          string
+	Bio           string
+	OnionAddr     string
+	Version       string
+	PoWDifficulty int // filled from policy.json on every request
+}
+
+// peerInfo is served at /holler.json so senders can discover admission
+// requirements before their first message.
+type peerInfo struct {
+	Onion         string `json:"onion"`
+	Version       string `json:"version"`
+	PoWDifficulty int    `json:"pow_difficulty"`
 }
 
 // Profile is the optional ~/.holler/profile.json format.
@@ -194,6 +205,10 @@ var homepageTmpl = template.Must(template.New("homepage").Parse(`<!DOCTYPE html>
   <span class="label">onion:</span>
 </div>
 <code class="peer-id">{{.OnionAddr}}.onion</code>
+<div class="field">
+  <span class="label">first contact:</span>
+  <span class="value">{{if .PoWDifficulty}}proof-of-work, {{.PoWDifficulty}} bits (holler send computes it){{else}}open{{end}}</span>
+</div>
 <div class="field">
   <span class="label">operator:</span>
   <span class="value">kass</span>
@@ -270,6 +285,16 @@ var homepageTmpl = template.Must(template.New("homepage").Parse(`<!DOCTYPE html>
 </body>
 </html>`))
 
+// advertisedPoW returns the proof-of-work difficulty strangers must meet,
+// read from policy.json so `holler policy pow` applies without a restart.
+func advertisedPoW() int {
+	policy, err := identity.LoadPolicy()
+	if err != nil {
+		return 0
+	}
+	return policy.PoWDifficulty
+}
+
 // StartHomepage serves the agent profile page on the given listener.
 // Blocks until ctx is cancelled.
 func StartHomepage(ctx context.Context, ln net.Listener, data HomepageData) {
@@ -280,10 +305,22 @@ func StartHomepage(ctx context.Context, ln net.Listener, data HomepageData) {
 		w.Header().Set("X-Content-Type-Options", "nosniff")
 		w.Header().Set("X-Frame-Options", "DENY")
 		w.Header().Set("Referrer-Policy", "no-referrer")
-		if err := homepageTmpl.Execute(w, data); err != nil {
+		page := data
+		page.PoWDifficulty = advertisedPoW()
+		if err := homepageTmpl.Execute(w, page); err != nil {
 			fmt.Fprintf(os.Stderr, "tor homepage: template: %v\n", err)
 		}
 	})
+	mux.HandleFunc("/holler.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		json.NewEncoder(w).Encode(peerInfo{
+			Onion:         data.OnionAddr,
+			Version:       data.Version,
+			PoWDifficulty: advertisedPoW(),
+		})
+	})
 
 	srv := &http.Server{
 		Handler:        mux,
@@ -1,24 +1,137 @@
 package node
 
 import (
-	"context"
 	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"time"
 
-	bineed25519 "github.com/cretz/bine/torutil/ed25519"
-
 	"github.com/1F47E/holler/message"
 )
 
+// errFrameTooLarge is returned by recvFrame for a length prefix over maxMessageSize.
+var errFrameTooLarge = errors.New("frame too large")
+
 const (
 	maxMessageSize = 1 << 20 // 1MB
 	readTimeout    = 30 * time.Second
 	writeTimeout   = 10 * time.Second
 )
 
+// Message-port protocol. A connection either carries a single bare envelope
+// frame (the original protocol, still accepted) or starts with a hello frame
+// in which both sides list the protocol versions and optional features they
+// support. The receiver answers with a hello holding the agreed set: the
+// highest common version and the common features. No common version is
+// answered with an empty version list and the connection is closed.
+const (
+	ProtocolVersion = 1
+
+	// FeatureSession allows several envelopes, each answered in turn, on one
+	// connection. Without it the connection closes after one exchange.
+	FeatureSession = "session"
+
+	// FeatureReceipts makes the receiver answer a stored envelope with a
+	// "received" receipt instead of a bare "ack".
+	FeatureReceipts = "receipts"
+
+	// FeatureSigV2 means the receiver verifies v2 envelope signatures.
+	// Without it envelopes are signed v1.
+	FeatureSigV2 = "sig-v2"
+)
+
+// Hello advertises (or, in the receiver's answer, fixes) protocol versions
+// and optional features.
+type Hello struct {
+	Versions []int    `json:"versions"`
+	Features []string `json:"features,omitempty"`
+}
+
+// helloFrame wraps Hello so it can't be mistaken for an envelope.
+type helloFrame struct {
+	Hello *Hello `json:"hello"`
+}
+
+// LocalHello is what this build supports.
+func LocalHello() Hello {
+	return Hello{Versions: []int{ProtocolVersion}, Features: []string{FeatureSession, FeatureReceipts, FeatureSigV2}}
+}
+
+// Has reports whether feature is in the hello's feature list.
+func (h Hello) Has(feature string) bool {
+	for _, f := range h.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// Version returns the first (agreed) version, or 0 if there is none.
+func (h Hello) Version() int {
+	if len(h.Versions) == 0 {
+		return 0
+	}
+	return h.Versions[0]
+}
+
+// Negotiate returns the highest version and the features both sides support.
+// ok is false when there is no common version.
+func Negotiate(ours, theirs Hello) (agreed Hello, ok bool) {
+	best := 0
+	for _, v := range ours.Versions {
+		for _, w := range theirs.Versions {
+			if v == w && v > best {
+				best = v
+			}
+		}
+	}
+	if best == 0 {
+		return Hello{Versions: []int{}}, false
+	}
+	agreed.Versions = []int{best}
+	for _, f := range ours.Features {
+		if theirs.Has(f) {
+			agreed.Features = append(agreed.Features, f)
+		}
+	}
+	return agreed, true
+}
+
+// SendHello writes a hello frame.
+func SendHello(conn net.Conn, h Hello) error {
+	data, err := json.Marshal(helloFrame{Hello: &h})
+	if err != nil {
+		return fmt.Errorf("marshal hello: %w", err)
+	}
+	return sendFrame(conn, data)
+}
+
+// RecvHello reads a hello frame. A frame that isn't a hello is an error.
+func RecvHello(conn net.Conn, timeout time.Duration) (Hello, error) {
+	data, err := recvFrame(conn, timeout)
+	if err != nil {
+		return Hello{}, err
+	}
+	h, ok := parseHello(data)
+	if !ok {
+		return Hello{}, fmt.Errorf("expected hello frame")
+	}
+	return h, nil
+}
+
+// parseHello reports whether a frame is a hello and decodes it.
+func parseHello(data []byte) (Hello, bool) {
+	var f helloFrame
+	if err := json.Unmarshal(data, &f); err != nil || f.Hello == nil {
+		return Hello{}, false
+	}
+	return *f.Hello, true
+}
+
 // SendTor sends an envelope over a raw TCP connection using length-prefixed framing.
 // Format: [4 bytes big-endian length][JSON payload]
 func SendTor(conn net.Conn, env *message.Envelope) error {
@@ -26,6 +139,10 @@ func SendTor(conn net.Conn, env *message.Envelope) error {
 	if err != nil {
 		return fmt.Errorf("marshal envelope: %w", err)
 	}
+	return sendFrame(conn, data)
+}
+
+func sendFrame(conn net.Conn, data []byte) error {
 	if len(data) > maxMessageSize {
 		return fmt.Errorf("message too large: %d bytes (max %d)", len(data), maxMessageSize)
 	}
@@ -49,7 +166,17 @@ func SendTor(conn net.Conn, env *message.Envelope) error {
 
 // RecvTor reads an envelope from a raw TCP connection using length-prefixed framing.
 func RecvTor(conn net.Conn) (*message.Envelope, error) {
-	if err := conn.SetReadDeadline(time.Now().Add(readTimeout)); err != nil {
+	data, err := recvFrame(conn, readTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return message.UnmarshalEnvelope(data)
+}
+
+// recvFrame reads one length-prefixed frame, with a separate deadline for the
+// 4-byte length prefix so an idle peer can be dropped well before readTimeout.
+func recvFrame(conn net.Conn, headerTimeout time.Duration) ([]byte, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(headerTimeout)); err != nil {
 		return nil, fmt.Errorf("set read deadline: %w", err)
 	}
 
@@ -59,8 +186,15 @@ func RecvTor(conn net.Conn) (*message.Envelope, error) {
 		return nil, fmt.Errorf("read length: %w", err)
 	}
 	msgLen := binary.BigEndian.Uint32(lenBuf[:])
-	if msgLen == 0 || msgLen > maxMessageSize {
-		return nil, fmt.Errorf("invalid message length: %d", msgLen)
+	if msgLen > maxMessageSize {
+		return nil, fmt.Errorf("%w: %d bytes (max %d)", errFrameTooLarge, msgLen, maxMessageSize)
+	}
+	if msgLen == 0 {
+		return nil, fmt.Errorf("invalid message length: 0")
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(readTimeout)); err != nil {
+		return nil, fmt.Errorf("set read deadline: %w", err)
 	}
 
 	// Read payload
@@ -68,53 +202,5 @@ func RecvTor(conn net.Conn) (*message.Envelope, error) {
 	if _, err := io.ReadFull(conn, payload); err != nil {
 		return nil, fmt.Errorf("read payload: %w", err)
 	}
-
-	return message.UnmarshalEnvelope(payload)
-}
-
-// HandleTorConnections accepts incoming TCP connections on the TorNode message port
-// and dispatches verified messages to the handler. Runs until ctx is cancelled.
-func HandleTorConnections(ctx context.Context, tn *TorNode, myKeyPair bineed25519.KeyPair, handler MessageHandler) {
-	for {
-		conn, err := tn.AcceptMsg()
-		if err != nil {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				logf("tor: accept error: %v", err)
-				continue
-			}
-		}
-		go handleTorConn(conn, tn.OnionAddr, myKeyPair, handler)
-	}
-}
-
-func handleTorConn(conn net.Conn, myOnionAddr string, myKeyPair bineed25519.KeyPair, handler MessageHandler) {
-	defer conn.Close()
-
-	env, err := RecvTor(conn)
-	if err != nil {
-		logf("tor: recv error: %v", err)
-		return
-	}
-
-	valid, err := env.Verify()
-	if err != nil || !valid {
-		logf("tor: invalid signature from %s", env.From)
-		return
-	}
-
-	handler(env)
-
-	// Send ack
-	ack := message.NewEnvelope(myOnionAddr, env.From, "ack", env.ID)
-	ack.ThreadID = env.ThreadID
-	if err := ack.Sign(myKeyPair); err != nil {
-		logf("tor: sign ack: %v", err)
-		return
-	}
-	if err := SendTor(conn, ack); err != nil {
-		logf("tor: send ack: %v", err)
-	}
+	return payload, nil
 }
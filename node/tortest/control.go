@@ -0,0 +1,171 @@
+package tortest
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/cretz/bine/control"
+	"github.com/cretz/bine/torutil"
+	"github.com/cretz/bine/torutil/ed25519"
+)
+
+// serveControl speaks the control protocol on one connection until the
+// client disconnects or the server drops it. Onions created on a connection
+// are removed when it closes, like non-detached onions in real Tor.
+func (s *Server) serveControl(conn net.Conn) {
+	s.mu.Lock()
+	s.ctrlConns[conn] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.ctrlConns, conn)
+		for id, o := range s.onions {
+			if o.owner == conn {
+				delete(s.onions, id)
+			}
+		}
+		s.mu.Unlock()
+	}()
+
+	r := textproto.NewReader(bufio.NewReader(conn))
+	w := textproto.NewWriter(bufio.NewWriter(conn))
+	authenticated := false
+
+	for {
+		line, err := r.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, args, _ := strings.Cut(line, " ")
+		cmd = strings.ToUpper(cmd)
+
+		var reply []string
+		switch {
+		case cmd == "PROTOCOLINFO":
+			reply = []string{
+				"250-PROTOCOLINFO 1",
+				"250-AUTH METHODS=NULL",
+				fmt.Sprintf("250-VERSION Tor=%q", TorVersion),
+				"250 OK",
+			}
+		case cmd == "AUTHENTICATE":
+			authenticated = true
+			reply = []string{"250 OK"}
+		case cmd == "QUIT":
+			w.PrintfLine("250 closing connection")
+			return
+		case !authenticated:
+			w.PrintfLine("514 Authentication required.")
+			return
+		case cmd == "GETINFO":
+			reply = s.getInfo(args)
+		case cmd == "ADD_ONION":
+			reply = s.addOnion(conn, args)
+		case cmd == "DEL_ONION":
+			reply = s.delOnion(conn, args)
+		default:
+			reply = []string{fmt.Sprintf("510 Unrecognized command %q", cmd)}
+		}
+		for _, l := range reply {
+			if err := w.PrintfLine("%s", l); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) getInfo(args string) []string {
+	var reply []string
+	for _, key := range strings.Fields(args) {
+		switch key {
+		case "version":
+			reply = append(reply, "250-version="+TorVersion)
+		default:
+			return []string{fmt.Sprintf("552 Unrecognized key %q", key)}
+		}
+	}
+	return append(reply, "250 OK")
+}
+
+// addOnion handles "ADD_ONION <keytype>:<blob> [Flags=..] Port=virt[,target]...".
+func (s *Server) addOnion(conn net.Conn, args string) []string {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return []string{"512 Missing argument to ADD_ONION"}
+	}
+
+	var kp ed25519.KeyPair
+	var newKey bool
+	keyType, blob, _ := strings.Cut(fields[0], ":")
+	switch keyType {
+	case string(control.KeyTypeED25519V3):
+		key, err := control.ED25519KeyFromBlob(blob)
+		if err != nil {
+			return []string{"513 Failed to decode ED25519-V3 key"}
+		}
+		kp = key.KeyPair
+	case string(control.KeyTypeNew):
+		var err error
+		if kp, err = ed25519.GenerateKey(nil); err != nil {
+			return []string{"551 Failed to generate onion key"}
+		}
+		newKey = true
+	default:
+		return []string{fmt.Sprintf("513 Invalid key type %q", keyType)}
+	}
+
+	targets := make(map[int]string)
+	for _, f := range fields[1:] {
+		val, ok := strings.CutPrefix(f, "Port=")
+		if !ok {
+			continue // Flags, MaxStreams, ClientAuth are accepted and ignored
+		}
+		virt, target, _ := strings.Cut(val, ",")
+		port, err := strconv.Atoi(virt)
+		if err != nil || port <= 0 || port > 65535 {
+			return []string{fmt.Sprintf("512 Invalid VIRTPORT/TARGET %q", val)}
+		}
+		if target == "" {
+			target = "127.0.0.1:" + virt
+		} else if _, err := strconv.Atoi(target); err == nil {
+			target = "127.0.0.1:" + target
+		}
+		targets[port] = target
+	}
+	if len(targets) == 0 {
+		return []string{"512 Missing 'Port' argument"}
+	}
+
+	id := strings.ToLower(torutil.OnionServiceIDFromPrivateKey(kp))
+	s.mu.Lock()
+	if _, exists := s.onions[id]; exists {
+		s.mu.Unlock()
+		return []string{"550 Onion address collision"}
+	}
+	s.onions[id] = &onion{owner: conn, targets: targets}
+	s.mu.Unlock()
+
+	reply := []string{"250-ServiceID=" + id}
+	if newKey {
+		reply = append(reply, "250-PrivateKey="+(&control.ED25519Key{KeyPair: kp}).Blob())
+	}
+	return append(reply, "250 OK")
+}
+
+func (s *Server) delOnion(conn net.Conn, args string) []string {
+	id := strings.ToLower(strings.TrimSpace(args))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.onions[id]
+	if !ok || o.owner != conn {
+		return []string{"552 Unknown Onion Service id"}
+	}
+	delete(s.onions, id)
+	return []string{"250 OK"}
+}
@@ -0,0 +1,127 @@
+package tortest
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"time"
+)
+
+// SOCKS5 constants (RFC 1928) used by the proxy.
+const (
+	socksVersion     = 0x05
+	socksNoAuth      = 0x00
+	socksCmdConnect  = 0x01
+	socksAtypIPv4    = 0x01
+	socksAtypDomain  = 0x03
+	socksAtypIPv6    = 0x04
+	socksSucceeded   = 0x00
+	socksFailure     = 0x01
+	socksHostUnreach = 0x04
+	socksCmdUnsupp   = 0x07
+	socksAtypUnsupp  = 0x08
+)
+
+const socksHandshakeTimeout = 10 * time.Second
+
+// serveSOCKS handles one SOCKS5 client: no-auth negotiation, a CONNECT to a
+// .onion host, then a byte pipe to the registered local target.
+func (s *Server) serveSOCKS(conn net.Conn) {
+	if !s.track(conn) {
+		return
+	}
+	defer s.untrack(conn)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(socksHandshakeTimeout))
+
+	// Greeting: VER NMETHODS METHODS...
+	var hdr [2]byte
+	if _, err := io.ReadFull(conn, hdr[:]); err != nil || hdr[0] != socksVersion {
+		return
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+	if _, err := conn.Write([]byte{socksVersion, socksNoAuth}); err != nil {
+		return
+	}
+
+	// Request: VER CMD RSV ATYP DST.ADDR DST.PORT
+	var req [4]byte
+	if _, err := io.ReadFull(conn, req[:]); err != nil || req[0] != socksVersion {
+		return
+	}
+	if req[1] != socksCmdConnect {
+		socksReply(conn, socksCmdUnsupp)
+		return
+	}
+	var host string
+	switch req[3] {
+	case socksAtypDomain:
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return
+		}
+		host = string(name)
+	case socksAtypIPv4, socksAtypIPv6:
+		// Tor would connect to clearnet here; the fake only routes onions.
+		socksReply(conn, socksAtypUnsupp)
+		return
+	default:
+		socksReply(conn, socksAtypUnsupp)
+		return
+	}
+	var portBuf [2]byte
+	if _, err := io.ReadFull(conn, portBuf[:]); err != nil {
+		return
+	}
+	port := int(binary.BigEndian.Uint16(portBuf[:]))
+
+	target, delay, err := s.route(host, port)
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	if err != nil {
+		socksReply(conn, socksHostUnreach)
+		return
+	}
+	upstream, err := net.DialTimeout("tcp", target, socksHandshakeTimeout)
+	if err != nil {
+		socksReply(conn, socksFailure)
+		return
+	}
+	if !s.track(upstream) {
+		return
+	}
+	defer s.untrack(upstream)
+	defer upstream.Close()
+	if err := socksReply(conn, socksSucceeded); err != nil {
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	done := make(chan struct{}, 2)
+	go pipe(upstream, conn, done)
+	go pipe(conn, upstream, done)
+	<-done
+	<-done
+}
+
+// socksReply writes a reply with a zero IPv4 bound address.
+func socksReply(conn net.Conn, code byte) error {
+	_, err := conn.Write([]byte{socksVersion, code, 0x00, socksAtypIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+func pipe(dst, src net.Conn, done chan<- struct{}) {
+	io.Copy(dst, src)
+	if tc, ok := dst.(*net.TCPConn); ok {
+		tc.CloseWrite()
+	}
+	done <- struct{}{}
+}
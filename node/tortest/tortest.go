@@ -0,0 +1,226 @@
+// Package tortest runs an in-process stand-in for a local Tor daemon so the
+// real node.TorTransport code paths can be exercised without installing tor.
+//
+// A Server exposes a control port that understands the subset of the control
+// protocol holler uses (PROTOCOLINFO, AUTHENTICATE, ADD_ONION, DEL_ONION,
+// GETINFO version) and a SOCKS5 proxy that routes <serviceid>.onion:<port>
+// to the local targets registered with ADD_ONION. Tor restarts, slow circuits
+// and unreachable onions can be simulated while the server is running.
+package tortest
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1F47E/holler/node"
+)
+
+// TorVersion is reported by PROTOCOLINFO and GETINFO version.
+const TorVersion = "0.4.8.13"
+
+// Server is a fake Tor daemon: control port plus SOCKS5 proxy on 127.0.0.1.
+type Server struct {
+	ctrlLn  net.Listener
+	socksLn net.Listener
+
+	mu          sync.Mutex
+	onions      map[string]*onion // service ID → registration
+	ctrlConns   map[net.Conn]struct{}
+	proxied     map[net.Conn]struct{} // both ends of open SOCKS5 streams
+	unreachable map[string]bool
+	circuit     time.Duration
+	down        bool
+	closing     bool
+
+	wg sync.WaitGroup
+}
+
+// onion is a service registered through ADD_ONION.
+type onion struct {
+	owner   net.Conn       // control connection that created it
+	targets map[int]string // virtual port → local target address
+}
+
+// Start launches a Server on random local ports.
+func Start() (*Server, error) {
+	ctrlLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("tortest: bind control port: %w", err)
+	}
+	socksLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		ctrlLn.Close()
+		return nil, fmt.Errorf("tortest: bind socks port: %w", err)
+	}
+	s := &Server{
+		ctrlLn:      ctrlLn,
+		socksLn:     socksLn,
+		onions:      make(map[string]*onion),
+		ctrlConns:   make(map[net.Conn]struct{}),
+		proxied:     make(map[net.Conn]struct{}),
+		unreachable: make(map[string]bool),
+	}
+	s.wg.Add(2)
+	go s.acceptLoop(ctrlLn, s.serveControl)
+	go s.acceptLoop(socksLn, s.serveSOCKS)
+	return s, nil
+}
+
+// ControlAddr returns the control port address.
+func (s *Server) ControlAddr() string { return s.ctrlLn.Addr().String() }
+
+// SOCKSAddr returns the SOCKS5 proxy address.
+func (s *Server) SOCKSAddr() string { return s.socksLn.Addr().String() }
+
+// Transport returns a node.TorTransport wired to this server.
+func (s *Server) Transport() *node.TorTransport {
+	return &node.TorTransport{
+		SOCKSAddr:   s.SOCKSAddr(),
+		ControlAddr: s.ControlAddr(),
+	}
+}
+
+// Onions returns the currently registered service IDs, sorted.
+func (s *Server) Onions() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.onions))
+	for id := range s.onions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Restart simulates a Tor restart: every control connection is dropped and
+// every onion service is forgotten, so GETINFO fails on existing connections
+// and clients must reconnect and re-register.
+func (s *Server) Restart() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.ctrlConns {
+		c.Close()
+	}
+	s.ctrlConns = make(map[net.Conn]struct{})
+	s.onions = make(map[string]*onion)
+}
+
+// SetDown simulates Tor being stopped. While down, the control port and the
+// SOCKS5 proxy accept connections and close them immediately. Going down
+// also drops all existing state, as Restart does.
+func (s *Server) SetDown(down bool) {
+	if down {
+		s.Restart()
+	}
+	s.mu.Lock()
+	s.down = down
+	s.mu.Unlock()
+}
+
+// SetCircuitDelay delays every SOCKS5 CONNECT by d before it is answered,
+// simulating slow circuit construction.
+func (s *Server) SetCircuitDelay(d time.Duration) {
+	s.mu.Lock()
+	s.circuit = d
+	s.mu.Unlock()
+}
+
+// SetUnreachable makes SOCKS5 connections to serviceID fail as if its
+// descriptor could not be fetched, whether or not it is registered.
+func (s *Server) SetUnreachable(serviceID string, unreachable bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if unreachable {
+		s.unreachable[strings.ToLower(serviceID)] = true
+	} else {
+		delete(s.unreachable, strings.ToLower(serviceID))
+	}
+}
+
+// Close stops both listeners, drops every control connection and SOCKS5
+// stream, and waits for all of their goroutines to finish.
+func (s *Server) Close() error {
+	err := s.ctrlLn.Close()
+	if serr := s.socksLn.Close(); serr != nil && err == nil {
+		err = serr
+	}
+	s.Restart()
+	s.mu.Lock()
+	s.closing = true
+	for c := range s.proxied {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) acceptLoop(ln net.Listener, serve func(net.Conn)) {
+	defer s.wg.Done()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		if s.isDown() {
+			conn.Close()
+			continue
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			serve(conn)
+		}()
+	}
+}
+
+// track registers one end of a SOCKS5 stream so Close can cut it. It
+// returns false, closing conn, if the server is already closing.
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		conn.Close()
+		return false
+	}
+	s.proxied[conn] = struct{}{}
+	return true
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.proxied, conn)
+	s.mu.Unlock()
+}
+
+func (s *Server) isDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.down
+}
+
+// route resolves a SOCKS5 target host:port to a local address.
+func (s *Server) route(host string, port int) (string, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := strings.TrimSuffix(strings.ToLower(host), ".onion")
+	if id == strings.ToLower(host) {
+		return "", 0, fmt.Errorf("not an onion address: %s", host)
+	}
+	if s.unreachable[id] {
+		return "", s.circuit, fmt.Errorf("%s.onion unreachable", id)
+	}
+	o, ok := s.onions[id]
+	if !ok {
+		return "", s.circuit, fmt.Errorf("%s.onion not registered", id)
+	}
+	target, ok := o.targets[port]
+	if !ok {
+		return "", s.circuit, fmt.Errorf("%s.onion has no port %d", id, port)
+	}
+	return target, s.circuit, nil
+}
@@ -0,0 +1,58 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/cretz/bine/control"
+)
+
+// Transport names accepted by NewTransport (and the --transport flag).
+const (
+	TransportTor      = "tor"
+	TransportLoopback = "loopback"
+)
+
+// Transport is how holler reaches peers and publishes its own service.
+// TorTransport is the production implementation; LoopbackTransport lets
+// several agents talk on one machine without a Tor daemon.
+type Transport interface {
+	// Name returns the transport identifier, as accepted by NewTransport.
+	Name() string
+	// CheckDial verifies the transport can reach peers (send/ping).
+	CheckDial() error
+	// CheckListen verifies the transport can publish a service (listen/daemon).
+	CheckListen() error
+	// Dial connects to a virtual port (9000 or 80) on a peer's address.
+	Dial(ctx context.Context, addr string, port int) (net.Conn, error)
+	// Listen publishes the message and homepage ports for the given key.
+	Listen(onionKey *control.ED25519Key, onionAddr string) (Listener, error)
+}
+
+// Listener is a published holler service returned by Transport.Listen.
+type Listener interface {
+	// Addr returns the 56-char onion address the service is published under.
+	Addr() string
+	// AcceptMsg waits for the next connection on the message port (9000).
+	AcceptMsg() (net.Conn, error)
+	// HTTPListener returns the listener for the homepage port (80).
+	HTTPListener() net.Listener
+	// Ping checks that the service is still published.
+	Ping() error
+	// Close unpublishes the service and closes all listeners.
+	Close() error
+}
+
+// NewTransport returns the transport registered under name.
+// An empty name selects Tor.
+func NewTransport(name string) (Transport, error) {
+	switch name {
+	case "", TransportTor:
+		return NewTorTransport(), nil
+	case TransportLoopback:
+		return NewLoopbackTransport(""), nil
+	default:
+		return nil, fmt.Errorf("unknown transport %q (want %s or %s)", name, TransportTor, TransportLoopback)
+	}
+}